@@ -27,6 +27,24 @@ func main() {
 	_ = auth.GetTokenBlacklist()
 	log.Println("Token blacklist initialized")
 
+	// Deliver scheduled messages in the background
+	api.StartMessageScheduler()
+
+	// Hard-delete disappearing messages once they expire
+	api.StartMessageReaper()
+
+	// Apply message retention policies
+	api.StartRetentionPurger()
+
+	// Close polls at their deadline
+	api.StartPollCloser()
+
+	// Attach link previews to new messages
+	api.StartLinkPreviewer()
+
+	// Push new messages to recipients' devices
+	api.StartPushDispatcher()
+
 	// Setup Gin router
 	router := gin.Default()
 	router.SetTrustedProxies([]string{"127.0.0.1"})
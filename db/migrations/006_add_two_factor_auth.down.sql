@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS user_recovery_codes;
+
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_enabled;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret;
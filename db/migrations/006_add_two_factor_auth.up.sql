@@ -0,0 +1,16 @@
+-- TOTP two-factor authentication settings on users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;
+
+-- Single-use recovery codes (only the SHA-256 hash is stored)
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes (user_id);
@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN mobile_no TYPE VARCHAR(15);
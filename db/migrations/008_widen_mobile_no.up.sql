@@ -0,0 +1,2 @@
+-- E.164 numbers are up to 15 digits plus the leading "+"
+ALTER TABLE users ALTER COLUMN mobile_no TYPE VARCHAR(16);
@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS status_text;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
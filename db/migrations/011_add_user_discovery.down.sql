@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_display_name_prefix;
+DROP INDEX IF EXISTS idx_users_username_prefix;
+DROP INDEX IF EXISTS idx_users_mobile_hash;
+
+ALTER TABLE users DROP COLUMN IF EXISTS mobile_hash;
@@ -0,0 +1,9 @@
+-- SHA-256 (hex) of the E.164 mobile number, used for contact matching
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mobile_hash VARCHAR(64);
+UPDATE users SET mobile_hash = encode(sha256(convert_to(mobile_no, 'UTF8')), 'hex') WHERE mobile_no IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_mobile_hash ON users (mobile_hash) WHERE mobile_hash IS NOT NULL;
+
+-- Prefix search on username and display name
+CREATE INDEX IF NOT EXISTS idx_users_username_prefix ON users (lower(username) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_display_name_prefix ON users (lower(display_name) text_pattern_ops);
@@ -0,0 +1,5 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_dm_privacy_check;
+ALTER TABLE users DROP COLUMN IF EXISTS dm_privacy;
+
+DROP TABLE IF EXISTS user_contacts;
+DROP TABLE IF EXISTS user_blocks;
@@ -0,0 +1,24 @@
+-- Users a person has blocked
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked_id ON user_blocks (blocked_id);
+
+-- Users a person has saved as contacts (used by the "contacts" privacy setting)
+CREATE TABLE IF NOT EXISTS user_contacts (
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    contact_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (owner_id, contact_id),
+    CHECK (owner_id <> contact_id)
+);
+
+-- Who may send DMs to the user or add them to groups
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dm_privacy VARCHAR(20) NOT NULL DEFAULT 'everyone';
+ALTER TABLE users ADD CONSTRAINT users_dm_privacy_check
+    CHECK (dm_privacy IN ('everyone', 'contacts', 'nobody'));
@@ -0,0 +1,15 @@
+-- First-contact DM threads held for the receiver to accept, decline or block.
+-- While a request is not accepted, the sender's DMs are hidden from the receiver.
+CREATE TABLE IF NOT EXISTS message_requests (
+    id SERIAL PRIMARY KEY,
+    sender_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    receiver_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP,
+    UNIQUE (sender_id, receiver_id),
+    CHECK (sender_id <> receiver_id),
+    CONSTRAINT message_requests_status_check CHECK (status IN ('pending', 'accepted', 'declined'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_requests_receiver_status ON message_requests (receiver_id, status);
@@ -0,0 +1,14 @@
+-- Revocable invite links for groups (only the SHA-256 hash of the token is stored)
+CREATE TABLE IF NOT EXISTS group_invites (
+    id SERIAL PRIMARY KEY,
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    max_uses INTEGER CHECK (max_uses > 0),
+    use_count INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_invites_group_id ON group_invites (group_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS group_join_requests;
+
+ALTER TABLE groups DROP CONSTRAINT IF EXISTS groups_join_policy_check;
+ALTER TABLE groups DROP COLUMN IF EXISTS join_policy;
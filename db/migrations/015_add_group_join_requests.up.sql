@@ -0,0 +1,21 @@
+-- How users outside a group can get in: only via admins/invites, by asking, or freely
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS join_policy VARCHAR(20) NOT NULL DEFAULT 'invite_only';
+ALTER TABLE groups ADD CONSTRAINT groups_join_policy_check
+    CHECK (join_policy IN ('invite_only', 'request', 'open'));
+
+-- Requests to join groups with the "request" policy
+CREATE TABLE IF NOT EXISTS group_join_requests (
+    id SERIAL PRIMARY KEY,
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    note VARCHAR(280),
+    decided_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT group_join_requests_status_check CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled'))
+);
+
+-- At most one open request per user and group
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_join_requests_pending
+    ON group_join_requests (group_id, user_id) WHERE status = 'pending';
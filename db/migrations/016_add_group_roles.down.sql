@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_group_members_owner;
+
+DROP INDEX IF EXISTS idx_group_admin_check;
+ALTER TABLE group_members DROP COLUMN IF EXISTS is_admin;
+ALTER TABLE group_members ADD COLUMN is_admin BOOLEAN DEFAULT FALSE;
+UPDATE group_members SET is_admin = role IN ('owner', 'admin');
+CREATE INDEX IF NOT EXISTS idx_group_admin_check ON group_members (group_id, is_admin);
+
+ALTER TABLE group_members DROP CONSTRAINT IF EXISTS group_members_role_check;
+ALTER TABLE group_members DROP COLUMN IF EXISTS role;
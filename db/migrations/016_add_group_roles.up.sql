@@ -0,0 +1,23 @@
+-- Replace the single admin flag with a role per member
+ALTER TABLE group_members ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'member';
+
+UPDATE group_members gm
+SET role = CASE
+    WHEN gm.member_id = g.creator_id THEN 'owner'
+    WHEN gm.is_admin THEN 'admin'
+    ELSE 'member'
+END
+FROM groups g
+WHERE g.id = gm.group_id;
+
+ALTER TABLE group_members ADD CONSTRAINT group_members_role_check
+    CHECK (role IN ('owner', 'admin', 'moderator', 'member', 'read_only'));
+
+-- is_admin is now derived from the role so the admin limit and existing readers keep working
+DROP INDEX IF EXISTS idx_group_admin_check;
+ALTER TABLE group_members DROP COLUMN IF EXISTS is_admin;
+ALTER TABLE group_members ADD COLUMN is_admin BOOLEAN GENERATED ALWAYS AS (role IN ('owner', 'admin')) STORED;
+CREATE INDEX IF NOT EXISTS idx_group_admin_check ON group_members (group_id, is_admin);
+
+-- A group has exactly one owner
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_members_owner ON group_members (group_id) WHERE role = 'owner';
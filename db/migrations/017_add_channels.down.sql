@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_messages_group_created_id;
+
+DROP TRIGGER IF EXISTS group_members_count ON group_members;
+DROP FUNCTION IF EXISTS update_group_member_count();
+
+ALTER TABLE groups DROP COLUMN IF EXISTS member_count;
+ALTER TABLE groups DROP CONSTRAINT IF EXISTS groups_group_type_check;
+ALTER TABLE groups DROP COLUMN IF EXISTS group_type;
@@ -0,0 +1,28 @@
+-- Broadcast channels: one-to-many groups where only admins post
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS group_type VARCHAR(20) NOT NULL DEFAULT 'group';
+ALTER TABLE groups ADD CONSTRAINT groups_group_type_check CHECK (group_type IN ('group', 'channel'));
+
+-- Denormalized member count so limit checks don't count thousands of rows
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS member_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE groups g
+SET member_count = (SELECT COUNT(*) FROM group_members gm WHERE gm.group_id = g.id);
+
+CREATE OR REPLACE FUNCTION update_group_member_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE groups SET member_count = member_count + 1 WHERE id = NEW.group_id;
+    ELSIF TG_OP = 'DELETE' THEN
+        UPDATE groups SET member_count = member_count - 1 WHERE id = OLD.group_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER group_members_count
+    AFTER INSERT OR DELETE ON group_members
+    FOR EACH ROW EXECUTE FUNCTION update_group_member_count();
+
+-- Keyset pagination over a group's history (newest first)
+CREATE INDEX IF NOT EXISTS idx_messages_group_created_id
+    ON messages (group_id, created_at DESC, id DESC) WHERE group_id IS NOT NULL;
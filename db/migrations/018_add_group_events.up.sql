@@ -0,0 +1,13 @@
+-- Audit trail of group changes. group_id has no foreign key so the trail outlives
+-- the group (e.g. the record of who deleted it).
+CREATE TABLE IF NOT EXISTS group_events (
+    id SERIAL PRIMARY KEY,
+    group_id INTEGER NOT NULL,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    event_type VARCHAR(40) NOT NULL,
+    target_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_events_group_created ON group_events (group_id, created_at DESC);
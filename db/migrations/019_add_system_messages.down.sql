@@ -0,0 +1,5 @@
+DELETE FROM messages WHERE message_type = 'system';
+
+ALTER TABLE messages DROP COLUMN IF EXISTS group_event_id;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_message_type_check;
+ALTER TABLE messages DROP COLUMN IF EXISTS message_type;
@@ -0,0 +1,6 @@
+-- Distinguish regular messages from system messages (group events shown in the conversation)
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS message_type VARCHAR(20) NOT NULL DEFAULT 'text';
+ALTER TABLE messages ADD CONSTRAINT messages_message_type_check CHECK (message_type IN ('text', 'system'));
+
+-- The event a system message describes
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS group_event_id INTEGER REFERENCES group_events(id) ON DELETE SET NULL;
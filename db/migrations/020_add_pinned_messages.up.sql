@@ -0,0 +1,20 @@
+-- Pinned messages. A pin belongs to a conversation: a group, or the DM between
+-- user_low_id and user_high_id (stored in ascending order).
+CREATE TABLE IF NOT EXISTS pinned_messages (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER NOT NULL UNIQUE REFERENCES messages(id) ON DELETE CASCADE,
+    group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+    user_low_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    user_high_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    pinned_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    pinned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT pinned_messages_conversation_check CHECK (
+        (group_id IS NOT NULL AND user_low_id IS NULL AND user_high_id IS NULL) OR
+        (group_id IS NULL AND user_low_id IS NOT NULL AND user_high_id IS NOT NULL AND user_low_id < user_high_id)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_group ON pinned_messages (group_id, pinned_at DESC)
+    WHERE group_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_dm ON pinned_messages (user_low_id, user_high_id, pinned_at DESC)
+    WHERE group_id IS NULL;
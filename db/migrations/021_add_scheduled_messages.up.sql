@@ -0,0 +1,25 @@
+-- Messages waiting to be delivered at send_at by the scheduler
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id SERIAL PRIMARY KEY,
+    sender_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    receiver_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    send_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    message_id INTEGER REFERENCES messages(id) ON DELETE SET NULL, -- the delivered message
+    failure_reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT scheduled_messages_status_check CHECK (status IN ('pending', 'sent', 'cancelled', 'failed')),
+    CONSTRAINT scheduled_messages_receiver_or_group_check CHECK (
+        (receiver_id IS NOT NULL AND group_id IS NULL) OR
+        (receiver_id IS NULL AND group_id IS NOT NULL)
+    )
+);
+
+-- The scheduler polls for due pending messages
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages (send_at)
+    WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_sender ON scheduled_messages (sender_id, send_at)
+    WHERE status = 'pending';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS dm_timers;
+
+ALTER TABLE groups DROP COLUMN IF EXISTS message_ttl_seconds;
+
+DROP INDEX IF EXISTS idx_messages_expires_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS expires_at;
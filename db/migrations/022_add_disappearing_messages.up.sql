@@ -0,0 +1,18 @@
+-- Disappearing messages: new messages are stamped with an expiry from the conversation's
+-- timer and hard-deleted by the reaper once it passes
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages (expires_at) WHERE expires_at IS NOT NULL;
+
+-- Group timers (NULL = messages don't disappear)
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS message_ttl_seconds INTEGER;
+
+-- DM timers, one row per conversation (user_low_id < user_high_id)
+CREATE TABLE IF NOT EXISTS dm_timers (
+    user_low_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_high_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_ttl_seconds INTEGER NOT NULL,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_low_id, user_high_id),
+    CONSTRAINT dm_timers_order_check CHECK (user_low_id < user_high_id)
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_messages_created_at;
+
+DROP TABLE IF EXISTS archived_messages;
+DROP TABLE IF EXISTS legal_holds;
+DROP TABLE IF EXISTS retention_policies;
@@ -0,0 +1,55 @@
+-- Retention policies: messages older than retain_days are deleted or archived by the
+-- purge worker. A policy with group_id NULL is the server-wide default for DMs and for
+-- groups without a policy of their own.
+CREATE TABLE IF NOT EXISTS retention_policies (
+    id SERIAL PRIMARY KEY,
+    group_id INTEGER UNIQUE REFERENCES groups(id) ON DELETE CASCADE,
+    retain_days INTEGER NOT NULL,
+    action VARCHAR(10) NOT NULL DEFAULT 'delete',
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT retention_policies_retain_days_check CHECK (retain_days > 0),
+    CONSTRAINT retention_policies_action_check CHECK (action IN ('delete', 'archive'))
+);
+
+-- At most one server-wide policy
+CREATE UNIQUE INDEX IF NOT EXISTS idx_retention_policies_server ON retention_policies ((group_id IS NULL))
+    WHERE group_id IS NULL;
+
+-- Legal holds exempt every message sent or received by a user, or sent in a group,
+-- from retention until they are released. No foreign keys on the subject, so the
+-- record of a hold outlives it.
+CREATE TABLE IF NOT EXISTS legal_holds (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER,
+    group_id INTEGER,
+    reason TEXT NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    released_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    released_at TIMESTAMP,
+    CONSTRAINT legal_holds_subject_check CHECK (
+        (user_id IS NOT NULL AND group_id IS NULL) OR
+        (user_id IS NULL AND group_id IS NOT NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_legal_holds_active_user ON legal_holds (user_id) WHERE released_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_legal_holds_active_group ON legal_holds (group_id) WHERE released_at IS NULL;
+
+-- Messages moved out of messages by an "archive" policy
+CREATE TABLE IF NOT EXISTS archived_messages (
+    id INTEGER PRIMARY KEY, -- the original message ID
+    sender_id INTEGER NOT NULL,
+    receiver_id INTEGER,
+    group_id INTEGER,
+    content TEXT NOT NULL,
+    message_type VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP,
+    archived_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    policy_id INTEGER
+);
+
+-- The purge worker scans messages oldest first
+CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages (created_at);
@@ -0,0 +1,9 @@
+-- Client-generated IDs make sending idempotent: a retry with the same ID returns the
+-- original message instead of storing a duplicate. Unique per sender.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_message_id VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_client_message_id ON messages (sender_id, client_message_id)
+    WHERE client_message_id IS NOT NULL;
+
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS client_message_id VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scheduled_messages_client_message_id ON scheduled_messages (sender_id, client_message_id)
+    WHERE client_message_id IS NOT NULL;
@@ -0,0 +1,12 @@
+ALTER TABLE archived_messages DROP COLUMN IF EXISTS payload;
+
+DROP TABLE IF EXISTS message_mentions;
+
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS payload;
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS message_type;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS render_hints;
+ALTER TABLE messages DROP COLUMN IF EXISTS payload;
+UPDATE messages SET message_type = 'text' WHERE message_type NOT IN ('text', 'system');
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_message_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_message_type_check CHECK (message_type IN ('text', 'system'));
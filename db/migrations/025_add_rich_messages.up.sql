@@ -0,0 +1,25 @@
+-- More message types; structured ones carry a JSON payload validated per type
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_message_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_message_type_check
+    CHECK (message_type IN ('text', 'markdown', 'system', 'location', 'contact', 'poll'));
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS payload JSONB;
+
+-- Mention and link spans computed when the message is stored, returned to clients as rendering hints
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS render_hints JSONB;
+
+-- Scheduled messages keep their type and payload until delivery
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS message_type VARCHAR(20) NOT NULL DEFAULT 'text';
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS payload JSONB;
+
+-- Group members mentioned in a message, for notifications and the mentions feed
+CREATE TABLE IF NOT EXISTS message_mentions (
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_mentions_user ON message_mentions (user_id, message_id DESC);
+
+-- Archived messages keep their payload
+ALTER TABLE archived_messages ADD COLUMN IF NOT EXISTS payload JSONB;
@@ -0,0 +1,36 @@
+-- Polls are created from poll messages; deleting the message deletes the poll
+CREATE TABLE IF NOT EXISTS polls (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER NOT NULL UNIQUE REFERENCES messages(id) ON DELETE CASCADE,
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    created_by INTEGER NOT NULL REFERENCES users(id),
+    question TEXT NOT NULL,
+    multiple_choice BOOLEAN NOT NULL DEFAULT false,
+    anonymous BOOLEAN NOT NULL DEFAULT false,
+    closes_at TIMESTAMP,
+    closed_at TIMESTAMP,
+    closed_by INTEGER REFERENCES users(id) ON DELETE SET NULL, -- NULL when closed at the deadline
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The poll closer looks for open polls past their deadline
+CREATE INDEX IF NOT EXISTS idx_polls_closes_at ON polls (closes_at)
+    WHERE closed_at IS NULL AND closes_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    poll_id INTEGER NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL, -- index into the poll message's options, from 0
+    text TEXT NOT NULL,
+    PRIMARY KEY (poll_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    poll_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    voted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (poll_id, position, user_id),
+    FOREIGN KEY (poll_id, position) REFERENCES poll_options(poll_id, position) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_poll_votes_user ON poll_votes (poll_id, user_id);
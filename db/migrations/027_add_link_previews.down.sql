@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS link_previews;
+
+DROP INDEX IF EXISTS idx_messages_link_preview_pending;
+ALTER TABLE messages DROP COLUMN IF EXISTS link_preview_pending;
+ALTER TABLE messages DROP COLUMN IF EXISTS link_preview;
@@ -0,0 +1,13 @@
+-- Preview of the first link in a message, attached by the link previewer after the message is stored
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS link_preview JSONB;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS link_preview_pending BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS idx_messages_link_preview_pending ON messages (id) WHERE link_preview_pending;
+
+-- Fetched previews by URL, so a link shared many times is fetched once. preview is NULL when the fetch failed.
+CREATE TABLE IF NOT EXISTS link_previews (
+    url TEXT PRIMARY KEY,
+    preview JSONB,
+    fetched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_previews_fetched_at ON link_previews (fetched_at);
@@ -0,0 +1,6 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS forward_count;
+
+DROP INDEX IF EXISTS idx_messages_forwarded_from_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS forwarded_from_sender_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS forwarded_from_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS is_forwarded;
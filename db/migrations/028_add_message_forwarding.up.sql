@@ -0,0 +1,9 @@
+-- Forwarded copies point at the original message (the root when a forward is forwarded again)
+-- and keep its author, so the marker survives the original being deleted
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS is_forwarded BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_id INTEGER REFERENCES messages(id) ON DELETE SET NULL;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_sender_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_messages_forwarded_from_id ON messages (forwarded_from_id) WHERE forwarded_from_id IS NOT NULL;
+
+-- How many copies were forwarded from an original message
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forward_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,23 @@
+-- Per-user settings of a DM (peer_id) or group (group_id) conversation. Conversations
+-- without a row use the defaults: not muted, not archived, notified of every message.
+CREATE TABLE IF NOT EXISTS conversation_settings (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    peer_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    group_id INTEGER REFERENCES groups(id) ON DELETE CASCADE,
+    muted BOOLEAN NOT NULL DEFAULT false,
+    muted_until TIMESTAMP, -- NULL while muted means until unmuted
+    archived BOOLEAN NOT NULL DEFAULT false,
+    notification_level VARCHAR(10) NOT NULL DEFAULT 'all',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT conversation_settings_target_check CHECK ((peer_id IS NULL) <> (group_id IS NULL)),
+    CONSTRAINT conversation_settings_level_check CHECK (notification_level IN ('all', 'mentions', 'none'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversation_settings_peer ON conversation_settings (user_id, peer_id)
+    WHERE peer_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversation_settings_group ON conversation_settings (user_id, group_id)
+    WHERE group_id IS NOT NULL;
+-- Group fan-out looks up the settings of every member
+CREATE INDEX IF NOT EXISTS idx_conversation_settings_group_id ON conversation_settings (group_id)
+    WHERE group_id IS NOT NULL;
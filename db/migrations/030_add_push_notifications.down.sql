@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS push_deliveries;
+
+DROP INDEX IF EXISTS idx_messages_push_pending;
+ALTER TABLE messages DROP COLUMN IF EXISTS push_pending;
+
+DROP TABLE IF EXISTS push_devices;
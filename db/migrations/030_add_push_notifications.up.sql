@@ -0,0 +1,32 @@
+-- Devices that receive push notifications. A token belongs to one user at a time:
+-- registering it again (after logging in as someone else) moves it.
+CREATE TABLE IF NOT EXISTS push_devices (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    platform VARCHAR(10) NOT NULL,
+    token TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT push_devices_platform_check CHECK (platform IN ('fcm', 'apns', 'webpush')),
+    UNIQUE (platform, token)
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_devices_user_id ON push_devices (user_id);
+
+-- New messages wait here until the push dispatcher works out who to notify
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS push_pending BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS idx_messages_push_pending ON messages (id) WHERE push_pending;
+
+-- One notification to one device, kept until it is delivered or runs out of attempts
+CREATE TABLE IF NOT EXISTS push_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    device_id INTEGER NOT NULL REFERENCES push_devices(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (message_id, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_deliveries_next_attempt_at ON push_deliveries (next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_push_deliveries_device_id ON push_deliveries (device_id);
@@ -0,0 +1,3 @@
+-- The recorded rows can't be told apart from requests accepted by hand, and keeping them
+-- is harmless, so there is nothing to undo
+SELECT 1;
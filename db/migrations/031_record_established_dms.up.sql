@@ -0,0 +1,8 @@
+-- DMs that were never held are now recorded as accepted message requests when they
+-- start, so a conversation stays established after its messages expire or are purged.
+-- Record the conversations that already exist.
+INSERT INTO message_requests (sender_id, receiver_id, status, responded_at)
+SELECT DISTINCT m.sender_id, m.receiver_id, 'accepted', NOW()
+FROM messages m
+WHERE m.group_id IS NULL AND m.receiver_id IS NOT NULL AND m.sender_id <> m.receiver_id
+ON CONFLICT (sender_id, receiver_id) DO NOTHING;
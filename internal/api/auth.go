@@ -55,11 +55,42 @@ func getEnvDuration(key string, defaultDuration time.Duration) time.Duration {
 	return defaultDuration
 }
 
+// getEnvInt returns the integer from environment variable or default value
+func getEnvInt(key string, defaultValue int) int {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		log.Printf("Failed to parse integer from %s=%s, using default", key, valueStr)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBool returns the boolean from environment variable or default value
+func getEnvBool(key string, defaultValue bool) bool {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		log.Printf("Failed to parse boolean from %s=%s, using default", key, valueStr)
+		return defaultValue
+	}
+	return value
+}
+
 // RegisterRequest defines the structure for user registration
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
 	MobileNo string `json:"mobile_no" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	Email    string `json:"email,omitempty"` // Optional, used for password resets
 }
 
 // LoginRequest defines the structure for user login
@@ -76,6 +107,33 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 
+	// Validate input formats
+	if err := validateUsername(req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mobileNo, err := normalizeMobileNo(req.MobileNo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var email *string
+	if req.Email != "" {
+		if err := validateEmail(req.Email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		email = &req.Email
+	}
+
+	// Enforce the password policy
+	if err := auth.GetPasswordPolicy().Validate(req.Password, req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Hash password using bcrypt
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -85,9 +143,23 @@ func RegisterHandler(c *gin.Context) {
 	}
 
 	// Insert user into database
-	query := `INSERT INTO users (username, mobile_no, password) VALUES ($1, $2, $3)`
-	_, err = db.GetDB().Exec(query, req.Username, req.MobileNo, string(hashedPassword))
+	query := `INSERT INTO users (username, mobile_no, mobile_hash, password, email) VALUES ($1, $2, $3, $4, $5)`
+	_, err = db.GetDB().Exec(query, req.Username, mobileNo, hashMobileNo(mobileNo), string(hashedPassword), email)
 	if err != nil {
+		// Tell the client which unique field is already taken
+		if constraint, ok := uniqueViolation(err); ok {
+			switch constraint {
+			case "users_username_key":
+				c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken", "field": "username"})
+			case "users_mobile_no_key":
+				c.JSON(http.StatusConflict, gin.H{"error": "Mobile number is already registered", "field": "mobile_no"})
+			case "users_email_key":
+				c.JSON(http.StatusConflict, gin.H{"error": "Email is already registered", "field": "email"})
+			default:
+				c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+			}
+			return
+		}
 		log.Printf("Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
 		return
@@ -106,12 +178,13 @@ func LoginHandler(c *gin.Context) {
 
 	// Fetch user by username
 	var user struct {
-		ID       int
-		Username string
-		Password string
+		ID          int
+		Username    string
+		Password    string
+		TOTPEnabled bool
 	}
-	query := `SELECT id, username, password FROM users WHERE username = $1`
-	err := db.GetDB().QueryRow(query, req.Username).Scan(&user.ID, &user.Username, &user.Password)
+	query := `SELECT id, username, password, totp_enabled FROM users WHERE username = $1`
+	err := db.GetDB().QueryRow(query, req.Username).Scan(&user.ID, &user.Username, &user.Password, &user.TOTPEnabled)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
@@ -129,6 +202,39 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
+	// With two-factor enabled, hand out a short-lived challenge token instead of access/refresh tokens
+	if user.TOTPEnabled {
+		challengeToken, err := generateTwoFactorChallenge(user.ID, user.Username)
+		if err != nil {
+			log.Printf("Error generating challenge token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "Two-factor authentication required",
+			"two_factor_required": true,
+			"challenge_token":     challengeToken,
+		})
+		return
+	}
+
+	accessTokenString, refreshTokenString, err := generateTokenPair(user.ID, user.Username)
+	if err != nil {
+		log.Printf("Error generating tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Login successful",
+		"access_token":  accessTokenString,
+		"refresh_token": refreshTokenString,
+	})
+}
+
+// generateTokenPair issues a signed access token and refresh token for a user
+func generateTokenPair(userID int, username string) (string, string, error) {
 	// Get token durations from environment or use defaults
 	accessTokenDuration := getEnvDuration("ACCESS_TOKEN_DURATION", 15*time.Minute)
 	refreshTokenDuration := getEnvDuration("REFRESH_TOKEN_DURATION", 7*24*time.Hour)
@@ -138,8 +244,9 @@ func LoginHandler(c *gin.Context) {
 
 	// Generate access token
 	accessClaims := jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
+		"user_id":  userID,
+		"username": username,
+		"iat":      time.Now().Unix(),
 		"exp":      time.Now().Add(accessTokenDuration).Unix(),
 		"type":     "access",
 		"jti":      tokenID,
@@ -148,8 +255,9 @@ func LoginHandler(c *gin.Context) {
 
 	// Generate refresh token
 	refreshClaims := jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
+		"user_id":  userID,
+		"username": username,
+		"iat":      time.Now().Unix(),
 		"exp":      time.Now().Add(refreshTokenDuration).Unix(),
 		"type":     "refresh",
 		"jti":      generateTokenID(), // Use a different ID for refresh token
@@ -160,23 +268,46 @@ func LoginHandler(c *gin.Context) {
 	jwtSecret := os.Getenv("JWT_SECRET")
 	accessTokenString, err := accessToken.SignedString([]byte(jwtSecret))
 	if err != nil {
-		log.Printf("Error generating access token: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
+		return "", "", err
 	}
 
 	refreshTokenString, err := refreshToken.SignedString([]byte(jwtSecret))
 	if err != nil {
-		log.Printf("Error generating refresh token: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
+		return "", "", err
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":       "Login successful",
-		"access_token":  accessTokenString,
-		"refresh_token": refreshTokenString,
-	})
+	return accessTokenString, refreshTokenString, nil
+}
+
+// tokenIssuedAt returns the iat claim of a token, or the zero time when it is missing
+func tokenIssuedAt(claims jwt.MapClaims) time.Time {
+	if iat, ok := claims["iat"].(float64); ok {
+		return time.Unix(int64(iat), 0)
+	}
+	return time.Time{}
+}
+
+// isSessionRevoked checks whether a token was issued before the user's last password change.
+// The in-memory revocation list is checked first; the database covers long-lived refresh
+// tokens across server restarts.
+func isSessionRevoked(claims jwt.MapClaims) (bool, error) {
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return true, nil
+	}
+
+	issuedAt := tokenIssuedAt(claims)
+	if auth.GetTokenBlacklist().IsUserTokenRevoked(int(userID), issuedAt) {
+		return true, nil
+	}
+
+	var revoked bool
+	query := `SELECT EXISTS(
+		SELECT 1 FROM users
+		WHERE id = $1 AND date_trunc('second', password_changed_at) > to_timestamp($2)
+	)`
+	err := db.GetDB().QueryRow(query, int(userID), issuedAt.Unix()).Scan(&revoked)
+	return revoked, err
 }
 
 // RefreshTokenRequest defines the structure for token refresh
@@ -222,6 +353,18 @@ func RefreshTokenHandler(c *gin.Context) {
 		return
 	}
 
+	// Check if the user's sessions were revoked by a password change
+	revoked, err := isSessionRevoked(claims)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+		return
+	}
+
 	// Check if the token's jti is blacklisted
 	if jti, ok := claims["jti"].(string); ok {
 		if auth.GetTokenBlacklist().IsBlacklisted(jti) {
@@ -264,6 +407,7 @@ func RefreshTokenHandler(c *gin.Context) {
 	accessClaims := jwt.MapClaims{
 		"user_id":  int(userId),
 		"username": username,
+		"iat":      time.Now().Unix(),
 		"exp":      time.Now().Add(accessTokenDuration).Unix(),
 		"type":     "access",
 		"jti":      generateTokenID(), // Add a unique token ID
@@ -357,12 +501,20 @@ func MeHandler(c *gin.Context) {
 
 	// Fetch user details from database
 	var user struct {
-		ID       int    `json:"user_id"`
-		Username string `json:"username"`
-	}
-
-	query := `SELECT id, username FROM users WHERE id = $1`
-	err := db.GetDB().QueryRow(query, userId).Scan(&user.ID, &user.Username)
+		ID             int     `json:"user_id"`
+		Username       string  `json:"username"`
+		MobileVerified bool    `json:"mobile_verified"`
+		DisplayName    *string `json:"display_name"`
+		AvatarURL      *string `json:"avatar_url"`
+		Bio            *string `json:"bio"`
+		StatusText     *string `json:"status_text"`
+		DMPrivacy      string  `json:"dm_privacy"`
+	}
+
+	query := `SELECT id, username, mobile_verified, display_name, avatar_url, bio, status_text, dm_privacy
+		FROM users WHERE id = $1`
+	err := db.GetDB().QueryRow(query, userId).Scan(&user.ID, &user.Username, &user.MobileVerified,
+		&user.DisplayName, &user.AvatarURL, &user.Bio, &user.StatusText, &user.DMPrivacy)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -0,0 +1,424 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Notification levels of a conversation
+const (
+	NotificationLevelAll      = "all"      // Every message
+	NotificationLevelMentions = "mentions" // Only messages mentioning the user (groups); DMs still notify
+	NotificationLevelNone     = "none"
+)
+
+// Page sizes for the inbox
+const (
+	defaultInboxLimit = 50
+	maxInboxLimit     = 100
+)
+
+// ConversationSettings are one user's settings for a DM or group conversation
+type ConversationSettings struct {
+	Muted             bool       `json:"muted"`
+	MutedUntil        *time.Time `json:"muted_until,omitempty"` // Unset while muted means until unmuted
+	Archived          bool       `json:"archived"`
+	NotificationLevel string     `json:"notification_level"`
+}
+
+// UpdateConversationSettingsRequest changes the fields that are set
+type UpdateConversationSettingsRequest struct {
+	Muted             *bool      `json:"muted,omitempty"`
+	MutedUntil        *time.Time `json:"muted_until,omitempty"` // Mutes until then
+	Archived          *bool      `json:"archived,omitempty"`
+	NotificationLevel *string    `json:"notification_level,omitempty"`
+}
+
+// InboxConversation is a DM or group in the user's conversation list
+type InboxConversation struct {
+	Type        string               `json:"type"`           // direct or group
+	User        *UserSummary         `json:"user,omitempty"` // The other participant of a DM
+	GroupID     *int                 `json:"group_id,omitempty"`
+	GroupName   *string              `json:"group_name,omitempty"`
+	LastMessage *Message             `json:"last_message,omitempty"`
+	Settings    ConversationSettings `json:"settings"`
+}
+
+// settingsTarget identifies a conversation whose settings are read or changed:
+// the DM with peerID, or the group groupID
+type settingsTarget struct {
+	peerID  int
+	groupID int
+}
+
+// defaultConversationSettings apply to conversations the user never changed
+func defaultConversationSettings() ConversationSettings {
+	return ConversationSettings{NotificationLevel: NotificationLevelAll}
+}
+
+// mutedNow reports whether a mute is in effect at now. Expired mutes read as unmuted.
+func (s ConversationSettings) mutedNow(now time.Time) bool {
+	return s.Muted && (s.MutedUntil == nil || s.MutedUntil.After(now))
+}
+
+// clearExpiredMute reports an expired mute as unmuted
+func (s *ConversationSettings) clearExpiredMute() {
+	if !s.mutedNow(time.Now()) {
+		s.Muted, s.MutedUntil = false, nil
+	}
+}
+
+// mutedSettingFilter matches settings rows (aliased s) with a mute in effect at the
+// time passed as the given parameter. Conversations without a row are not muted.
+func mutedSettingFilter(nowParam string) string {
+	return `COALESCE(s.muted AND (s.muted_until IS NULL OR s.muted_until > ` + nowParam + `), false)`
+}
+
+// loadConversationSettings returns the user's settings for a conversation, or the defaults
+func loadConversationSettings(userID int, target settingsTarget) (ConversationSettings, error) {
+	settings := defaultConversationSettings()
+	query := `SELECT muted, muted_until, archived, notification_level FROM conversation_settings
+		WHERE user_id = $1 AND (peer_id = $2 OR group_id = $3)`
+	err := db.GetDB().QueryRow(query, userID, nullableID(target.peerID), nullableID(target.groupID)).
+		Scan(&settings.Muted, &settings.MutedUntil, &settings.Archived, &settings.NotificationLevel)
+	if err != nil && err != sql.ErrNoRows {
+		return settings, err
+	}
+	settings.clearExpiredMute()
+	return settings, nil
+}
+
+// applySettingsUpdate validates a settings change and applies it to the current settings
+func applySettingsUpdate(settings *ConversationSettings, req UpdateConversationSettingsRequest) error {
+	if req.Muted == nil && req.MutedUntil == nil && req.Archived == nil && req.NotificationLevel == nil {
+		return &ValidationError{"Nothing to update"}
+	}
+
+	if req.MutedUntil != nil {
+		if req.Muted != nil && !*req.Muted {
+			return &ValidationError{"muted_until can't be set when unmuting"}
+		}
+		if !req.MutedUntil.After(time.Now()) {
+			return &ValidationError{"muted_until must be in the future"}
+		}
+		// Stored without a zone and compared against time.Now()
+		until := req.MutedUntil.Local()
+		settings.Muted, settings.MutedUntil = true, &until
+	} else if req.Muted != nil {
+		settings.Muted, settings.MutedUntil = *req.Muted, nil
+	}
+
+	if req.Archived != nil {
+		settings.Archived = *req.Archived
+	}
+
+	if req.NotificationLevel != nil {
+		switch *req.NotificationLevel {
+		case NotificationLevelAll, NotificationLevelMentions, NotificationLevelNone:
+			settings.NotificationLevel = *req.NotificationLevel
+		default:
+			return &ValidationError{"notification_level must be one of all, mentions or none"}
+		}
+	}
+	return nil
+}
+
+// updateConversationSettings applies a change to the user's settings for a conversation
+func updateConversationSettings(userID int, target settingsTarget, req UpdateConversationSettingsRequest) (ConversationSettings, error) {
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		return ConversationSettings{}, err
+	}
+	defer tx.Rollback()
+
+	// Create the row first so concurrent updates serialize on its lock
+	targetColumn, targetID := "peer_id", target.peerID
+	if target.groupID != 0 {
+		targetColumn, targetID = "group_id", target.groupID
+	}
+	query := `INSERT INTO conversation_settings (user_id, ` + targetColumn + `) VALUES ($1, $2)
+		ON CONFLICT (user_id, ` + targetColumn + `) WHERE ` + targetColumn + ` IS NOT NULL
+		DO UPDATE SET updated_at = NOW()
+		RETURNING muted, muted_until, archived, notification_level`
+	settings := defaultConversationSettings()
+	err = tx.QueryRow(query, userID, targetID).
+		Scan(&settings.Muted, &settings.MutedUntil, &settings.Archived, &settings.NotificationLevel)
+	if err != nil {
+		return settings, err
+	}
+	settings.clearExpiredMute()
+
+	if err := applySettingsUpdate(&settings, req); err != nil {
+		return settings, err
+	}
+
+	query = `UPDATE conversation_settings
+		SET muted = $1, muted_until = $2, archived = $3, notification_level = $4, updated_at = NOW()
+		WHERE user_id = $5 AND ` + targetColumn + ` = $6`
+	_, err = tx.Exec(query, settings.Muted, settings.MutedUntil, settings.Archived, settings.NotificationLevel,
+		userID, targetID)
+	if err != nil {
+		return settings, err
+	}
+
+	// Commit transaction
+	return settings, tx.Commit()
+}
+
+// dmSettingsTarget parses the :user_id URL parameter of DM settings endpoints
+func dmSettingsTarget(c *gin.Context, userID int) (settingsTarget, bool) {
+	otherUserID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return settingsTarget{}, false
+	}
+	if otherUserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot do this to yourself"})
+		return settingsTarget{}, false
+	}
+
+	var userExists bool
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`
+	if err := db.GetDB().QueryRow(query, otherUserID).Scan(&userExists); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify user"})
+		return settingsTarget{}, false
+	}
+	if !userExists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return settingsTarget{}, false
+	}
+	return settingsTarget{peerID: otherUserID}, true
+}
+
+// settingsTargetParam resolves the conversation of a settings endpoint: the group in
+// :group_id, which the user must be a member of, or the DM with :user_id
+func settingsTargetParam(c *gin.Context, userID int) (settingsTarget, bool) {
+	if c.Param("group_id") != "" {
+		groupID, _, ok := groupActionParam(c, userID, PermViewGroup)
+		return settingsTarget{groupID: groupID}, ok
+	}
+	return dmSettingsTarget(c, userID)
+}
+
+// GetConversationSettingsHandler returns the current user's settings for a DM or group
+func GetConversationSettingsHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	target, ok := settingsTargetParam(c, int(userIDInt))
+	if !ok {
+		return
+	}
+
+	settings, err := loadConversationSettings(int(userIDInt), target)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"settings": settings})
+}
+
+// UpdateConversationSettingsHandler mutes, archives or changes the notification level of a
+// DM or group for the current user. Only the fields sent are changed.
+func UpdateConversationSettingsHandler(c *gin.Context) {
+	var req UpdateConversationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	target, ok := settingsTargetParam(c, int(userIDInt))
+	if !ok {
+		return
+	}
+
+	settings, err := updateConversationSettings(int(userIDInt), target, req)
+	if err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error updating conversation settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Settings updated",
+		"settings": settings,
+	})
+}
+
+// GetInboxHandler lists the user's conversations with their last message. Archived
+// conversations are left out unless archived=true asks for just those; muted
+// conversations come after the others, and each part is ordered by latest activity.
+func GetInboxHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	archived := c.Query("archived") == "true"
+
+	limit := defaultInboxLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxInboxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxInboxLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	offset := 0
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		parsed, err := strconv.Atoi(offsetStr)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative number"})
+			return
+		}
+		offset = parsed
+	}
+
+	// DMs with at least one visible message, and every group the user is in
+	query := `
+		WITH conversations AS (
+		    SELECT CASE WHEN m.sender_id = $1 THEN m.receiver_id ELSE m.sender_id END AS peer_id,
+		           NULL::int AS group_id, MAX(m.id) AS last_message_id, MAX(m.created_at) AS last_activity
+		    FROM messages m
+		    WHERE m.group_id IS NULL AND (m.sender_id = $1 OR m.receiver_id = $1)
+		      AND ` + heldMessageFilter + ` AND ` + unexpiredMessageFilter + `
+		    GROUP BY 1
+		    UNION ALL
+		    SELECT NULL, gm.group_id, last.id, COALESCE(last.created_at, gm.joined_at)
+		    FROM group_members gm
+		    LEFT JOIN LATERAL (
+		        SELECT m.id, m.created_at FROM messages m
+		        WHERE m.group_id = gm.group_id AND ` + unexpiredMessageFilter + `
+		        ORDER BY m.id DESC
+		        LIMIT 1
+		    ) last ON true
+		    WHERE gm.member_id = $1
+		)
+		SELECT c.peer_id, p.username, p.display_name, p.avatar_url, c.group_id, g.group_name, c.last_message_id,
+		       COALESCE(s.muted, false), s.muted_until, COALESCE(s.archived, false),
+		       COALESCE(s.notification_level, 'all')
+		FROM conversations c
+		LEFT JOIN users p ON p.id = c.peer_id
+		LEFT JOIN groups g ON g.id = c.group_id
+		LEFT JOIN conversation_settings s ON s.user_id = $1 AND (s.peer_id = c.peer_id OR s.group_id = c.group_id)
+		WHERE COALESCE(s.archived, false) = $2
+		ORDER BY ` + mutedSettingFilter("$3") + `, c.last_activity DESC NULLS LAST, c.last_message_id DESC NULLS LAST
+		LIMIT $4 OFFSET $5`
+
+	rows, err := db.GetDB().Query(query, int(userIDInt), archived, time.Now(), limit, offset)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inbox"})
+		return
+	}
+	defer rows.Close()
+
+	conversations := []InboxConversation{}
+	var lastMessageIDs []int64
+	lastMessageOf := map[int64]int{}
+	for rows.Next() {
+		var conv InboxConversation
+		var peerID, lastMessageID sql.NullInt64
+		var username sql.NullString
+		var displayName, avatarURL *string
+		err := rows.Scan(&peerID, &username, &displayName, &avatarURL, &conv.GroupID, &conv.GroupName, &lastMessageID,
+			&conv.Settings.Muted, &conv.Settings.MutedUntil, &conv.Settings.Archived, &conv.Settings.NotificationLevel)
+		if err != nil {
+			log.Printf("Error scanning conversation: %v", err)
+			continue
+		}
+		conv.Settings.clearExpiredMute()
+
+		conv.Type = "group"
+		if peerID.Valid {
+			conv.Type = "direct"
+			conv.User = &UserSummary{ID: int(peerID.Int64), Username: username.String, DisplayName: displayName, AvatarURL: avatarURL}
+		}
+		if lastMessageID.Valid {
+			lastMessageIDs = append(lastMessageIDs, lastMessageID.Int64)
+			lastMessageOf[lastMessageID.Int64] = len(conversations)
+		}
+		conversations = append(conversations, conv)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inbox"})
+		return
+	}
+
+	if len(lastMessageIDs) > 0 {
+		query = `
+			SELECT ` + messageSelectColumns("$2") + `
+			FROM messages m
+			INNER JOIN users u ON u.id = m.sender_id
+			WHERE m.id = ANY($1)`
+		messageRows, err := db.GetDB().Query(query, pq.Array(lastMessageIDs), int(userIDInt))
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inbox"})
+			return
+		}
+		defer messageRows.Close()
+
+		for _, msg := range scanMessages(messageRows) {
+			conversations[lastMessageOf[int64(msg.ID)]].LastMessage = &msg
+		}
+	}
+
+	response := gin.H{"conversations": conversations}
+	if len(conversations) == limit {
+		response["next_offset"] = offset + limit
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	initTestDatabase sync.Once
+	testUserCount    atomic.Int64
+)
+
+// requireDatabase skips tests that need PostgreSQL unless TEST_DATABASE=1, in which case
+// the DB_* settings must point at a migrated database the tests may write to
+func requireDatabase(t *testing.T) {
+	t.Helper()
+	if os.Getenv("TEST_DATABASE") != "1" {
+		t.Skip("set TEST_DATABASE=1 and DB_* to run against a migrated database")
+	}
+	initTestDatabase.Do(db.Initialize)
+}
+
+// createTestUser inserts a user and removes it, with everything it owns, after the test
+func createTestUser(t *testing.T) int {
+	t.Helper()
+	var userID int
+	username := fmt.Sprintf("test_%d_%d", time.Now().UnixNano(), testUserCount.Add(1))
+	query := `INSERT INTO users (username, password) VALUES ($1, 'x') RETURNING id`
+	if err := db.GetDB().QueryRow(query, username).Scan(&userID); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, query := range []string{
+			`DELETE FROM legal_holds WHERE user_id = $1`,
+			`DELETE FROM messages WHERE sender_id = $1`,
+			`DELETE FROM group_members WHERE member_id = $1`,
+			`DELETE FROM groups WHERE creator_id = $1`,
+			`DELETE FROM users WHERE id = $1`,
+		} {
+			if _, err := db.GetDB().Exec(query, userID); err != nil {
+				t.Errorf("cleaning up user %d: %v", userID, err)
+			}
+		}
+	})
+	return userID
+}
+
+// createTestGroup inserts a group owned by ownerID with the other users as members
+func createTestGroup(t *testing.T, ownerID int, memberIDs ...int) int {
+	t.Helper()
+	var groupID int
+	query := `INSERT INTO groups (group_name, creator_id, member_count) VALUES ('Test group', $1, $2) RETURNING id`
+	if err := db.GetDB().QueryRow(query, ownerID, len(memberIDs)+1).Scan(&groupID); err != nil {
+		t.Fatalf("creating group: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, query := range []string{
+			`DELETE FROM legal_holds WHERE group_id = $1`,
+			`DELETE FROM messages WHERE group_id = $1`,
+			`DELETE FROM group_members WHERE group_id = $1`,
+			`DELETE FROM groups WHERE id = $1`,
+			`DELETE FROM group_events WHERE group_id = $1`,
+		} {
+			if _, err := db.GetDB().Exec(query, groupID); err != nil {
+				t.Errorf("cleaning up group %d: %v", groupID, err)
+			}
+		}
+	})
+
+	query = `INSERT INTO group_members (group_id, member_id, role) VALUES ($1, $2, $3)`
+	if _, err := db.GetDB().Exec(query, groupID, ownerID, RoleOwner); err != nil {
+		t.Fatalf("adding owner: %v", err)
+	}
+	for _, memberID := range memberIDs {
+		if _, err := db.GetDB().Exec(query, groupID, memberID, RoleMember); err != nil {
+			t.Fatalf("adding member: %v", err)
+		}
+	}
+	return groupID
+}
+
+// serveAs calls handler as userID with the given URL parameters
+func serveAs(handler gin.HandlerFunc, method string, userID int, params gin.Params) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/", nil)
+	c.Params = params
+	c.Set("user_id", float64(userID))
+	handler(c)
+	return w
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds for disappearing message timers (0 turns the timer off)
+const (
+	minMessageTTLSeconds = 30
+	maxMessageTTLSeconds = 365 * 24 * 60 * 60
+)
+
+// expiredMessageBatch is the most messages the reaper deletes per statement
+const expiredMessageBatch = 500
+
+// Expiry stamped on new messages from the conversation's timer, NULL when there is none.
+// groupMessageExpiry expects the group ID as $2; directMessageExpiry expects the sender
+// as $1 and the receiver as $2.
+const (
+	groupMessageExpiry = `(SELECT NOW() + make_interval(secs => message_ttl_seconds) FROM groups WHERE id = $2)`
+
+	directMessageExpiry = `(SELECT NOW() + make_interval(secs => message_ttl_seconds) FROM dm_timers
+		WHERE user_low_id = LEAST($1, $2) AND user_high_id = GREATEST($1, $2))`
+)
+
+// unexpiredMessageFilter hides messages whose timer ran out before the reaper got to them
+const unexpiredMessageFilter = `(m.expires_at IS NULL OR m.expires_at > NOW())`
+
+// SetTimerRequest defines the structure for setting a disappearing message timer
+type SetTimerRequest struct {
+	MessageTTLSeconds *int `json:"message_ttl_seconds" binding:"required"`
+}
+
+// validateMessageTTL checks a requested timer
+func validateMessageTTL(ttl int) error {
+	if ttl != 0 && (ttl < minMessageTTLSeconds || ttl > maxMessageTTLSeconds) {
+		return &ValidationError{fmt.Sprintf("message_ttl_seconds must be 0 (off) or between %d and %d",
+			minMessageTTLSeconds, maxMessageTTLSeconds)}
+	}
+	return nil
+}
+
+// SetGroupTimerHandler sets the disappearing message timer of a group (requires the edit_info permission)
+func SetGroupTimerHandler(c *gin.Context) {
+	var req SetTimerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message_ttl_seconds is required"})
+		return
+	}
+	if err := validateMessageTTL(*req.MessageTTLSeconds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermEditInfo)
+	if !ok {
+		return
+	}
+
+	ttl := sql.NullInt64{Int64: int64(*req.MessageTTLSeconds), Valid: *req.MessageTTLSeconds != 0}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timer"})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldTTL sql.NullInt64
+	query := `SELECT message_ttl_seconds FROM groups WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(query, groupID).Scan(&oldTTL); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timer"})
+		return
+	}
+
+	if oldTTL != ttl {
+		query = `UPDATE groups SET message_ttl_seconds = $1 WHERE id = $2`
+		if _, err := tx.Exec(query, ttl, groupID); err != nil {
+			log.Printf("Error updating timer: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timer"})
+			return
+		}
+
+		details := map[string]interface{}{"message_ttl_seconds": *req.MessageTTLSeconds}
+		if err := recordGroupEventTx(tx, groupID, int(userIDInt), EventTimerChanged, 0, details); err != nil {
+			log.Printf("Error recording group event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timer"})
+			return
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Timer updated",
+		"message_ttl_seconds": *req.MessageTTLSeconds,
+	})
+}
+
+// SetConversationTimerHandler sets the disappearing message timer of a DM conversation.
+// Either participant can change it.
+func SetConversationTimerHandler(c *gin.Context) {
+	var req SetTimerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message_ttl_seconds is required"})
+		return
+	}
+	if err := validateMessageTTL(*req.MessageTTLSeconds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	otherUserID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if otherUserID == int(userIDInt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot do this to yourself"})
+		return
+	}
+
+	var userExists bool
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`
+	if err := db.GetDB().QueryRow(query, otherUserID).Scan(&userExists); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timer"})
+		return
+	}
+	if !userExists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	lowID, highID := dmPair(int(userIDInt), otherUserID)
+	if *req.MessageTTLSeconds == 0 {
+		query = `DELETE FROM dm_timers WHERE user_low_id = $1 AND user_high_id = $2`
+		_, err = db.GetDB().Exec(query, lowID, highID)
+	} else {
+		query = `INSERT INTO dm_timers (user_low_id, user_high_id, message_ttl_seconds, updated_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_low_id, user_high_id)
+			DO UPDATE SET message_ttl_seconds = EXCLUDED.message_ttl_seconds,
+			              updated_by = EXCLUDED.updated_by, updated_at = NOW()`
+		_, err = db.GetDB().Exec(query, lowID, highID, *req.MessageTTLSeconds, int(userIDInt))
+	}
+	if err != nil {
+		log.Printf("Error updating timer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Timer updated",
+		"message_ttl_seconds": *req.MessageTTLSeconds,
+	})
+}
+
+// conversationTimer returns the DM timer between two users, nil when messages don't disappear
+func conversationTimer(userID, otherUserID int) (*int, error) {
+	lowID, highID := dmPair(userID, otherUserID)
+	var ttl int
+	query := `SELECT message_ttl_seconds FROM dm_timers WHERE user_low_id = $1 AND user_high_id = $2`
+	err := db.GetDB().QueryRow(query, lowID, highID).Scan(&ttl)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ttl, nil
+}
+
+// StartMessageReaper starts the background worker that hard-deletes expired messages.
+// Rows are claimed with SKIP LOCKED in small batches, so several replicas can run it
+// without blocking each other or holding long locks on messages.
+func StartMessageReaper() {
+	interval := getEnvDuration("MESSAGE_REAPER_INTERVAL", 30*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			deleteExpiredMessages()
+		}
+	}()
+	log.Printf("Message reaper started (every %s)", interval)
+}
+
+// deleteExpiredMessages deletes expired messages batch by batch until none are left.
+// Pins of deleted messages go with them (ON DELETE CASCADE). Messages under a legal
+// hold stay hidden but aren't deleted.
+func deleteExpiredMessages() {
+	query := `DELETE FROM messages WHERE id IN (
+		SELECT m.id FROM messages m
+		WHERE m.expires_at <= NOW() AND ` + legalHoldFilter + `
+		ORDER BY m.expires_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED)`
+	for {
+		result, err := db.GetDB().Exec(query, expiredMessageBatch)
+		if err != nil {
+			log.Printf("Error deleting expired messages: %v", err)
+			return
+		}
+		deleted, _ := result.RowsAffected()
+		if deleted < expiredMessageBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForwardMessageRequest lists the conversations a message is forwarded to
+type ForwardMessageRequest struct {
+	ReceiverIDs []int `json:"receiver_ids"`
+	GroupIDs    []int `json:"group_ids"`
+}
+
+// ForwardedCopy is one copy created by a forward
+type ForwardedCopy struct {
+	ReceiverID *int `json:"receiver_id,omitempty"`
+	GroupID    *int `json:"group_id,omitempty"`
+	SentMessage
+}
+
+// forwardOrigin is the original message a forwarded copy points at
+type forwardOrigin struct {
+	messageID int // The root original, also when a forward is forwarded again
+	senderID  int // Author of the original, 0 when the account is gone
+}
+
+// forwardSource is a message being forwarded, with the original it counts against
+type forwardSource struct {
+	msg    outgoingMessage
+	origin forwardOrigin
+}
+
+// nullableID stores a missing ID as NULL
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// maxForwardTargets is the most conversations a message can be forwarded to at once
+func maxForwardTargets() int {
+	return getEnvInt("MAX_FORWARD_TARGETS", 5)
+}
+
+// frequentlyForwardedAfter is the forward count after which a message can only be
+// forwarded to one conversation at a time, to slow down chain messages
+func frequentlyForwardedAfter() int {
+	return getEnvInt("FREQUENTLY_FORWARDED_AFTER", 5)
+}
+
+// forwardableMessage loads a message the user can read and turns it into a copy to send.
+// The copy keeps the content, payload and link preview of the message.
+func forwardableMessage(messageID, userID int) (forwardSource, error) {
+	var src forwardSource
+	var senderID int
+	var receiverID, groupID, rootID, rootSenderID sql.NullInt64
+	var isForwarded bool
+	query := `SELECT m.sender_id, m.receiver_id, m.group_id, m.content, m.message_type, m.payload, m.link_preview,
+			m.is_forwarded, m.forwarded_from_id, m.forwarded_from_sender_id
+		FROM messages m
+		WHERE m.id = $2 AND ` + heldMessageFilter + ` AND ` + unexpiredMessageFilter
+	err := db.GetDB().QueryRow(query, userID, messageID).Scan(&senderID, &receiverID, &groupID,
+		&src.msg.content, &src.msg.messageType, &src.msg.payload, &src.msg.linkPreview,
+		&isForwarded, &rootID, &rootSenderID)
+	if err == sql.ErrNoRows {
+		return src, &NotFoundError{"Message not found"}
+	}
+	if err != nil {
+		return src, err
+	}
+
+	// The forwarder must be able to read the message
+	if groupID.Valid {
+		if _, err := authorizeGroupAction(int(groupID.Int64), userID, PermViewGroup); err != nil {
+			return src, err
+		}
+	} else if userID != senderID && int64(userID) != receiverID.Int64 {
+		return src, &NotFoundError{"Message not found"}
+	}
+
+	switch src.msg.messageType {
+	case MessageTypeSystem:
+		return src, &ValidationError{"System messages can't be forwarded"}
+	case MessageTypePoll:
+		return src, &ValidationError{"Polls can't be forwarded"}
+	}
+
+	// Forwards of forwards point at the root original, so the count covers the whole chain
+	src.origin = forwardOrigin{messageID: messageID, senderID: senderID}
+	if isForwarded {
+		src.origin.senderID = int(rootSenderID.Int64)
+		if rootID.Valid {
+			src.origin.messageID = int(rootID.Int64)
+		}
+	}
+	src.msg.forwardedFrom = &src.origin
+	return src, nil
+}
+
+// uniqueIDs drops duplicate and non-positive IDs, keeping the order
+func uniqueIDs(ids []int) []int {
+	seen := map[int]bool{}
+	var unique []int
+	for _, id := range ids {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// checkForwardTargets checks the sender may post in every target conversation
+func checkForwardTargets(senderID int, receiverIDs, groupIDs []int) error {
+	for _, receiverID := range receiverIDs {
+		if err := checkDirectMessage(senderID, receiverID); err != nil {
+			return err
+		}
+	}
+	for _, groupID := range groupIDs {
+		if err := checkGroupMessage(senderID, groupID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForwardMessageHandler forwards a message the user can read into DMs and groups they can post to
+func ForwardMessageHandler(c *gin.Context) {
+	var req ForwardMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	messageID, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Optionally require a verified mobile number before messaging
+	if err := requireVerifiedPhone(int(userIDInt)); err != nil {
+		status := sendErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error checking phone verification: %v", err)
+			c.JSON(status, gin.H{"error": "Failed to forward message"})
+			return
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	receiverIDs, groupIDs := uniqueIDs(req.ReceiverIDs), uniqueIDs(req.GroupIDs)
+	targets := len(receiverIDs) + len(groupIDs)
+	if targets == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one receiver_id or group_id is required"})
+		return
+	}
+	if max := maxForwardTargets(); targets > max {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A message can be forwarded to at most %d conversations at once", max)})
+		return
+	}
+
+	src, err := forwardableMessage(messageID, int(userIDInt))
+	if err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward message"})
+		return
+	}
+
+	// Check every target before storing anything, so a forward is all or nothing
+	if err := checkForwardTargets(int(userIDInt), receiverIDs, groupIDs); err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward message"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward message"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the original so concurrent forwards can't get past the limit together.
+	// A deleted original no longer limits anything.
+	var forwardCount int
+	query := `SELECT forward_count FROM messages WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRow(query, src.origin.messageID).Scan(&forwardCount)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward message"})
+		return
+	}
+	if forwardCount >= frequentlyForwardedAfter() && targets > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This message has been forwarded many times and can only be forwarded to one conversation at a time"})
+		return
+	}
+
+	copies := []ForwardedCopy{}
+	for i := range receiverIDs {
+		sent, err := insertDirectMessageTx(tx, int(userIDInt), receiverIDs[i], src.msg)
+		if err != nil {
+			log.Printf("Error forwarding message: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward message"})
+			return
+		}
+		copies = append(copies, ForwardedCopy{ReceiverID: &receiverIDs[i], SentMessage: sent})
+	}
+	for i := range groupIDs {
+		sent, err := insertGroupMessageTx(tx, int(userIDInt), groupIDs[i], src.msg)
+		if err != nil {
+			log.Printf("Error forwarding message: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward message"})
+			return
+		}
+		copies = append(copies, ForwardedCopy{GroupID: &groupIDs[i], SentMessage: sent})
+	}
+
+	query = `UPDATE messages SET forward_count = forward_count + $2 WHERE id = $1`
+	if _, err := tx.Exec(query, src.origin.messageID, targets); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward message"})
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward message"})
+		return
+	}
+	if wantsLinkPreview(src.msg) {
+		wakeLinkPreviewer()
+	}
+	wakePushDispatcher()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "Message forwarded successfully",
+		"forwarded_to":  copies,
+		"forward_count": forwardCount + targets,
+	})
+}
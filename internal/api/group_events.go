@@ -0,0 +1,232 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Group event types
+const (
+	EventGroupCreated         = "group_created"
+	EventMemberAdded          = "member_added"
+	EventMemberJoined         = "member_joined"
+	EventMemberRemoved        = "member_removed"
+	EventMemberLeft           = "member_left"
+	EventRoleChanged          = "role_changed"
+	EventGroupRenamed         = "group_renamed"
+	EventJoinPolicyChanged    = "join_policy_changed"
+	EventOwnershipTransferred = "ownership_transferred"
+	EventMessagePinned        = "message_pinned"
+	EventMessageUnpinned      = "message_unpinned"
+	EventTimerChanged         = "timer_changed"
+	EventGroupDeleted         = "group_deleted"
+)
+
+// Message types
+const (
+	MessageTypeText     = "text"
+	MessageTypeMarkdown = "markdown"
+	MessageTypeSystem   = "system"
+	MessageTypeLocation = "location"
+	MessageTypeContact  = "contact"
+	MessageTypePoll     = "poll"
+)
+
+// Page sizes for the audit log
+const (
+	defaultGroupEventsLimit = 50
+	maxGroupEventsLimit     = 200
+)
+
+// GroupEvent is an entry in a group's audit trail
+type GroupEvent struct {
+	ID        int                    `json:"id"`
+	GroupID   int                    `json:"group_id"`
+	EventType string                 `json:"event_type"`
+	Actor     *UserSummary           `json:"actor"`
+	Target    *UserSummary           `json:"target"`
+	Details   map[string]interface{} `json:"details"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// recordGroupEventTx appends an entry to a group's audit trail inside tx and, unless the
+// group is being deleted, posts a system message describing it into the conversation.
+// targetUserID is 0 when the event isn't about a specific member.
+func recordGroupEventTx(tx *sql.Tx, groupID, actorID int, eventType string, targetUserID int, details map[string]interface{}) error {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	target := sql.NullInt64{Int64: int64(targetUserID), Valid: targetUserID != 0}
+
+	var eventID int
+	query := `INSERT INTO group_events (group_id, actor_id, event_type, target_user_id, details)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+	if err := tx.QueryRow(query, groupID, actorID, eventType, target, detailsJSON).Scan(&eventID); err != nil {
+		return err
+	}
+
+	if eventType == EventGroupDeleted {
+		return nil
+	}
+
+	var actorName, targetName sql.NullString
+	query = `SELECT (SELECT username FROM users WHERE id = $1), (SELECT username FROM users WHERE id = $2)`
+	if err := tx.QueryRow(query, actorID, target).Scan(&actorName, &targetName); err != nil {
+		return err
+	}
+
+	content := describeGroupEvent(eventType, actorName.String, targetName.String, details)
+	query = `INSERT INTO messages (sender_id, group_id, content, message_type, group_event_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, ` + groupMessageExpiry + `)`
+	_, err = tx.Exec(query, actorID, groupID, content, MessageTypeSystem, eventID)
+	return err
+}
+
+// describeGroupEvent renders the text of the system message for an event
+func describeGroupEvent(eventType, actor, target string, details map[string]interface{}) string {
+	switch eventType {
+	case EventGroupCreated:
+		return fmt.Sprintf("%s created the group \"%v\"", actor, details["group_name"])
+	case EventMemberAdded:
+		return fmt.Sprintf("%s added %s", actor, target)
+	case EventMemberJoined:
+		return fmt.Sprintf("%s joined", actor)
+	case EventMemberRemoved:
+		return fmt.Sprintf("%s removed %s", actor, target)
+	case EventMemberLeft:
+		return fmt.Sprintf("%s left", actor)
+	case EventRoleChanged:
+		return fmt.Sprintf("%s changed %s's role from %v to %v", actor, target, details["old_role"], details["new_role"])
+	case EventGroupRenamed:
+		return fmt.Sprintf("%s renamed the group to \"%v\"", actor, details["new_name"])
+	case EventJoinPolicyChanged:
+		return fmt.Sprintf("%s changed the join policy to %v", actor, details["join_policy"])
+	case EventOwnershipTransferred:
+		return fmt.Sprintf("%s transferred ownership to %s", actor, target)
+	case EventMessagePinned:
+		return fmt.Sprintf("%s pinned a message", actor)
+	case EventMessageUnpinned:
+		return fmt.Sprintf("%s unpinned a message", actor)
+	case EventTimerChanged:
+		if ttl, _ := details["message_ttl_seconds"].(int); ttl > 0 {
+			return fmt.Sprintf("%s set messages to disappear after %s", actor, time.Duration(ttl)*time.Second)
+		}
+		return fmt.Sprintf("%s turned off disappearing messages", actor)
+	default:
+		return fmt.Sprintf("%s updated the group", actor)
+	}
+}
+
+// GetGroupEventsHandler returns a group's audit trail, newest first
+// (requires the view_audit_log permission)
+func GetGroupEventsHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermViewAuditLog)
+	if !ok {
+		return
+	}
+
+	limit := defaultGroupEventsLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxGroupEventsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxGroupEventsLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	// ?before=<event id> returns older events
+	args := []interface{}{groupID, limit}
+	cursor := ""
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		before, err := strconv.Atoi(beforeStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before must be an event ID"})
+			return
+		}
+		args = append(args, before)
+		cursor = `AND e.id < $3`
+	}
+
+	query := `
+		SELECT e.id, e.group_id, e.event_type, e.details, e.created_at,
+		       a.id, a.username, a.display_name, a.avatar_url,
+		       t.id, t.username, t.display_name, t.avatar_url
+		FROM group_events e
+		LEFT JOIN users a ON a.id = e.actor_id
+		LEFT JOIN users t ON t.id = e.target_user_id
+		WHERE e.group_id = $1 ` + cursor + `
+		ORDER BY e.id DESC
+		LIMIT $2`
+
+	rows, err := db.GetDB().Query(query, args...)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve group events"})
+		return
+	}
+	defer rows.Close()
+
+	events := []GroupEvent{}
+	for rows.Next() {
+		var event GroupEvent
+		var detailsJSON []byte
+		var actorID, targetID sql.NullInt64
+		var actorName, targetName sql.NullString
+		var actor, target UserSummary
+		err := rows.Scan(&event.ID, &event.GroupID, &event.EventType, &detailsJSON, &event.CreatedAt,
+			&actorID, &actorName, &actor.DisplayName, &actor.AvatarURL,
+			&targetID, &targetName, &target.DisplayName, &target.AvatarURL)
+		if err != nil {
+			log.Printf("Error scanning group event: %v", err)
+			continue
+		}
+		if err := json.Unmarshal(detailsJSON, &event.Details); err != nil {
+			log.Printf("Error decoding group event details: %v", err)
+		}
+		if actorID.Valid {
+			actor.ID, actor.Username = int(actorID.Int64), actorName.String
+			event.Actor = &actor
+		}
+		if targetID.Valid {
+			target.ID, target.Username = int(targetID.Int64), targetName.String
+			event.Target = &target
+		}
+		events = append(events, event)
+	}
+
+	response := gin.H{"events": events}
+	if len(events) == limit {
+		response["next_before"] = events[len(events)-1].ID
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxInviteLifetimeHours caps how long an invite link may stay valid
+const maxInviteLifetimeHours = 30 * 24
+
+// CreateInviteRequest defines the structure for creating a group invite link.
+// Both limits are optional; an invite without them stays valid until revoked.
+type CreateInviteRequest struct {
+	MaxUses        *int `json:"max_uses,omitempty"`
+	ExpiresInHours *int `json:"expires_in_hours,omitempty"`
+}
+
+// JoinGroupRequest defines the structure for joining a group with an invite token
+type JoinGroupRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// GroupInvite is an active invite link as shown to group admins. The token itself is
+// only returned when the invite is created.
+type GroupInvite struct {
+	ID        int        `json:"id"`
+	GroupID   int        `json:"group_id"`
+	CreatedBy int        `json:"created_by"`
+	MaxUses   *int       `json:"max_uses"`
+	UseCount  int        `json:"use_count"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// generateInviteToken creates a random URL-safe invite token
+func generateInviteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashInviteToken returns the value stored in the database for an invite token
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateGroupInviteHandler creates an invite link for a group (requires the add_members permission)
+func CreateGroupInviteHandler(c *gin.Context) {
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermAddMembers)
+	if !ok {
+		return
+	}
+
+	if req.MaxUses != nil && *req.MaxUses < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_uses must be at least 1"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInHours != nil {
+		if *req.ExpiresInHours < 1 || *req.ExpiresInHours > maxInviteLifetimeHours {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("expires_in_hours must be between 1 and %d", maxInviteLifetimeHours),
+			})
+			return
+		}
+		expiry := time.Now().Add(time.Duration(*req.ExpiresInHours) * time.Hour)
+		expiresAt = &expiry
+	}
+
+	token, err := generateInviteToken()
+	if err != nil {
+		log.Printf("Error generating invite token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	invite := GroupInvite{
+		GroupID:   groupID,
+		CreatedBy: int(userIDInt),
+		MaxUses:   req.MaxUses,
+		ExpiresAt: expiresAt,
+	}
+	query := `INSERT INTO group_invites (group_id, created_by, token_hash, max_uses, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+	err = db.GetDB().QueryRow(query, groupID, int(userIDInt), hashInviteToken(token), req.MaxUses, expiresAt).
+		Scan(&invite.ID, &invite.CreatedAt)
+	if err != nil {
+		log.Printf("Error creating invite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	response := gin.H{
+		"message": "Invite created successfully",
+		"token":   token,
+		"invite":  invite,
+	}
+	if inviteURL := os.Getenv("GROUP_INVITE_URL"); inviteURL != "" {
+		response["invite_url"] = fmt.Sprintf("%s?token=%s", inviteURL, token)
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetGroupInvitesHandler lists a group's active invites (requires the add_members permission)
+func GetGroupInvitesHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermAddMembers)
+	if !ok {
+		return
+	}
+
+	query := `
+		SELECT id, group_id, created_by, max_uses, use_count, expires_at, created_at
+		FROM group_invites
+		WHERE group_id = $1 AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > $2)
+		  AND (max_uses IS NULL OR use_count < max_uses)
+		ORDER BY created_at DESC`
+
+	rows, err := db.GetDB().Query(query, groupID, time.Now())
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invites"})
+		return
+	}
+	defer rows.Close()
+
+	invites := []GroupInvite{}
+	for rows.Next() {
+		var invite GroupInvite
+		err := rows.Scan(&invite.ID, &invite.GroupID, &invite.CreatedBy, &invite.MaxUses, &invite.UseCount,
+			&invite.ExpiresAt, &invite.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning invite: %v", err)
+			continue
+		}
+		invites = append(invites, invite)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invites": invites})
+}
+
+// RevokeGroupInviteHandler revokes an invite so it can no longer be used (requires the add_members permission)
+func RevokeGroupInviteHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermAddMembers)
+	if !ok {
+		return
+	}
+
+	inviteID, err := strconv.Atoi(c.Param("invite_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+		return
+	}
+
+	query := `UPDATE group_invites SET revoked_at = NOW() WHERE id = $1 AND group_id = $2 AND revoked_at IS NULL`
+	result, err := db.GetDB().Exec(query, inviteID, groupID)
+	if err != nil {
+		log.Printf("Error revoking invite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked"})
+}
+
+// JoinGroupByInviteHandler adds the current user to the group an invite token belongs to
+func JoinGroupByInviteHandler(c *gin.Context) {
+	var req JoinGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the invite so concurrent joins are counted against max_uses correctly
+	var inviteID, groupID, useCount int
+	var maxUses sql.NullInt64
+	var expiresAt, revokedAt sql.NullTime
+	query := `SELECT id, group_id, max_uses, use_count, expires_at, revoked_at
+		FROM group_invites WHERE token_hash = $1 FOR UPDATE`
+	err = tx.QueryRow(query, hashInviteToken(req.Token)).Scan(&inviteID, &groupID, &maxUses, &useCount,
+		&expiresAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid invite link"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+		return
+	}
+
+	switch {
+	case revokedAt.Valid:
+		c.JSON(http.StatusGone, gin.H{"error": "This invite link has been revoked"})
+		return
+	case expiresAt.Valid && !expiresAt.Time.After(time.Now()):
+		c.JSON(http.StatusGone, gin.H{"error": "This invite link has expired"})
+		return
+	case maxUses.Valid && int64(useCount) >= maxUses.Int64:
+		c.JSON(http.StatusGone, gin.H{"error": "This invite link has reached its usage limit"})
+		return
+	}
+
+	// Add the member, enforcing the group limits under the group lock
+	if err := addMemberTx(tx, groupID, int(userIDInt), RoleMember); err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error joining group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+		return
+	}
+
+	query = `UPDATE group_invites SET use_count = use_count + 1 WHERE id = $1`
+	if _, err := tx.Exec(query, inviteID); err != nil {
+		log.Printf("Error recording invite use: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+		return
+	}
+
+	details := map[string]interface{}{"via": "invite", "invite_id": inviteID}
+	if err := recordGroupEventTx(tx, groupID, int(userIDInt), EventMemberJoined, 0, details); err != nil {
+		log.Printf("Error recording group event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Joined group successfully",
+		"group_id": groupID,
+	})
+}
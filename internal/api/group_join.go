@@ -0,0 +1,442 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Group join policies
+const (
+	JoinPolicyInviteOnly = "invite_only"
+	JoinPolicyRequest    = "request"
+	JoinPolicyOpen       = "open"
+)
+
+// UpdateJoinPolicyRequest defines the structure for changing a group's join policy
+type UpdateJoinPolicyRequest struct {
+	JoinPolicy string `json:"join_policy" binding:"required,oneof=invite_only request open"`
+}
+
+// JoinRequestBody defines the optional body of a request to join a group
+type JoinRequestBody struct {
+	Note string `json:"note,omitempty" binding:"max=280"`
+}
+
+// JoinRequest is a pending request to join a group, as shown to the group's admins
+type JoinRequest struct {
+	ID        int         `json:"id"`
+	GroupID   int         `json:"group_id"`
+	User      UserSummary `json:"user"`
+	Note      *string     `json:"note"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// UpdateJoinPolicyHandler changes how users outside a group can join it (requires the edit_info permission)
+func UpdateJoinPolicyHandler(c *gin.Context) {
+	var req UpdateJoinPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "join_policy must be one of: invite_only, request, open"})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermEditInfo)
+	if !ok {
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update join policy"})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldPolicy string
+	query := `SELECT join_policy FROM groups WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(query, groupID).Scan(&oldPolicy); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update join policy"})
+		return
+	}
+
+	if oldPolicy != req.JoinPolicy {
+		query = `UPDATE groups SET join_policy = $1 WHERE id = $2`
+		if _, err := tx.Exec(query, req.JoinPolicy, groupID); err != nil {
+			log.Printf("Error updating join policy: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update join policy"})
+			return
+		}
+
+		details := map[string]interface{}{"old_join_policy": oldPolicy, "join_policy": req.JoinPolicy}
+		if err := recordGroupEventTx(tx, groupID, int(userIDInt), EventJoinPolicyChanged, 0, details); err != nil {
+			log.Printf("Error recording group event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update join policy"})
+			return
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update join policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Join policy updated",
+		"join_policy": req.JoinPolicy,
+	})
+}
+
+// JoinGroupHandler joins an open group directly or files a join request for a group
+// with the "request" policy
+func JoinGroupHandler(c *gin.Context) {
+	// The body is optional
+	var req JoinRequestBody
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Get group ID from URL parameter
+	groupID, err := strconv.Atoi(c.Param("group_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var joinPolicy string
+	var alreadyMember bool
+	query := `SELECT join_policy,
+		EXISTS(SELECT 1 FROM group_members WHERE group_id = $1 AND member_id = $2)
+		FROM groups WHERE id = $1`
+	err = db.GetDB().QueryRow(query, groupID, int(userIDInt)).Scan(&joinPolicy, &alreadyMember)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+		return
+	}
+	if alreadyMember {
+		c.JSON(http.StatusConflict, gin.H{"error": "You are already a member of this group"})
+		return
+	}
+
+	switch joinPolicy {
+	case JoinPolicyOpen:
+		// Begin transaction
+		tx, err := db.GetDB().Begin()
+		if err != nil {
+			log.Printf("Error starting transaction: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+			return
+		}
+		defer tx.Rollback()
+
+		if err := addMemberTx(tx, groupID, int(userIDInt), RoleMember); err != nil {
+			if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Error joining group: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+			return
+		}
+
+		details := map[string]interface{}{"via": "open"}
+		if err := recordGroupEventTx(tx, groupID, int(userIDInt), EventMemberJoined, 0, details); err != nil {
+			log.Printf("Error recording group event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+			return
+		}
+
+		// Commit transaction
+		if err = tx.Commit(); err != nil {
+			log.Printf("Error committing transaction: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Joined group successfully",
+			"group_id": groupID,
+		})
+
+	case JoinPolicyRequest:
+		var requestID int
+		query = `INSERT INTO group_join_requests (group_id, user_id, note) VALUES ($1, $2, $3) RETURNING id`
+		err := db.GetDB().QueryRow(query, groupID, int(userIDInt), sql.NullString{String: req.Note, Valid: req.Note != ""}).
+			Scan(&requestID)
+		if err != nil {
+			if _, ok := uniqueViolation(err); ok {
+				c.JSON(http.StatusConflict, gin.H{"error": "You already have a pending request to join this group"})
+				return
+			}
+			log.Printf("Error creating join request: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request to join group"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":    "Join request sent to the group admins",
+			"request_id": requestID,
+		})
+
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": "This group can only be joined by invitation"})
+	}
+}
+
+// CancelJoinRequestHandler withdraws the current user's pending request to join a group
+func CancelJoinRequestHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Get group ID from URL parameter
+	groupID, err := strconv.Atoi(c.Param("group_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	query := `UPDATE group_join_requests SET status = 'cancelled', decided_at = NOW()
+		WHERE group_id = $1 AND user_id = $2 AND status = 'pending'`
+	result, err := db.GetDB().Exec(query, groupID, int(userIDInt))
+	if err != nil {
+		log.Printf("Error cancelling join request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel join request"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending join request for this group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Join request cancelled"})
+}
+
+// GetJoinRequestsHandler lists a group's pending join requests (requires the add_members permission)
+func GetJoinRequestsHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermAddMembers)
+	if !ok {
+		return
+	}
+
+	query := `
+		SELECT r.id, r.group_id, u.id, u.username, u.display_name, u.avatar_url, r.note, r.created_at
+		FROM group_join_requests r
+		INNER JOIN users u ON u.id = r.user_id
+		WHERE r.group_id = $1 AND r.status = 'pending'
+		ORDER BY r.created_at ASC`
+
+	rows, err := db.GetDB().Query(query, groupID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve join requests"})
+		return
+	}
+	defer rows.Close()
+
+	requests := []JoinRequest{}
+	for rows.Next() {
+		var req JoinRequest
+		err := rows.Scan(&req.ID, &req.GroupID, &req.User.ID, &req.User.Username, &req.User.DisplayName,
+			&req.User.AvatarURL, &req.Note, &req.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning join request: %v", err)
+			continue
+		}
+		requests = append(requests, req)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+// ApproveJoinRequestHandler adds the requesting user to the group (requires the add_members permission)
+func ApproveJoinRequestHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermAddMembers)
+	if !ok {
+		return
+	}
+
+	requestID, err := strconv.Atoi(c.Param("request_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve join request"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the request so two admins can't approve it at once
+	var requesterID int
+	query := `SELECT user_id FROM group_join_requests
+		WHERE id = $1 AND group_id = $2 AND status = 'pending' FOR UPDATE`
+	if err := tx.QueryRow(query, requestID, groupID).Scan(&requesterID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Join request not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve join request"})
+		return
+	}
+
+	// Add the member through the same checks as adding them directly
+	if err := addMemberTx(tx, groupID, requesterID, RoleMember); err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error adding member to group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve join request"})
+		return
+	}
+
+	query = `UPDATE group_join_requests SET decided_by = $1 WHERE id = $2`
+	if _, err := tx.Exec(query, int(userIDInt), requestID); err != nil {
+		log.Printf("Error recording approval: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve join request"})
+		return
+	}
+
+	details := map[string]interface{}{"via": "join_request", "request_id": requestID}
+	if err := recordGroupEventTx(tx, groupID, int(userIDInt), EventMemberAdded, requesterID, details); err != nil {
+		log.Printf("Error recording group event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve join request"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve join request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Join request approved"})
+}
+
+// RejectJoinRequestHandler turns down a pending join request (requires the add_members permission)
+func RejectJoinRequestHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermAddMembers)
+	if !ok {
+		return
+	}
+
+	requestID, err := strconv.Atoi(c.Param("request_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	query := `UPDATE group_join_requests SET status = 'rejected', decided_by = $1, decided_at = NOW()
+		WHERE id = $2 AND group_id = $3 AND status = 'pending'`
+	result, err := db.GetDB().Exec(query, int(userIDInt), requestID, groupID)
+	if err != nil {
+		log.Printf("Error rejecting join request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject join request"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Join request not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Join request rejected"})
+}
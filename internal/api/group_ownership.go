@@ -0,0 +1,220 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TransferOwnershipRequest defines the structure for handing a group to another member
+type TransferOwnershipRequest struct {
+	NewOwnerID int `json:"new_owner_id" binding:"required"`
+}
+
+// TransferOwnershipHandler makes another member the owner of a group. The previous owner
+// stays on as an admin, or as a member when the group is already at its admin limit.
+func TransferOwnershipHandler(c *gin.Context) {
+	var req TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermTransferOwner)
+	if !ok {
+		return
+	}
+
+	if req.NewOwnerID == int(userIDInt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already own this group"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the group so concurrent transfers and role changes are serialized
+	groupType, _, err := lockGroupTx(tx, groupID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+
+	// Re-check ownership under the lock
+	var ownerID int
+	query := `SELECT member_id FROM group_members WHERE group_id = $1 AND role = 'owner'`
+	if err := tx.QueryRow(query, groupID).Scan(&ownerID); err != nil && err != sql.ErrNoRows {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+	if ownerID != int(userIDInt) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the group owner can transfer ownership"})
+		return
+	}
+
+	var newOwnerRole string
+	var adminCount int
+	query = `SELECT role, (SELECT COUNT(*) FROM group_members WHERE group_id = $1 AND is_admin = true)
+		FROM group_members WHERE group_id = $1 AND member_id = $2`
+	if err := tx.QueryRow(query, groupID, req.NewOwnerID).Scan(&newOwnerRole, &adminCount); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "The new owner must be a member of this group"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+
+	// Promoting a non-admin adds one to the admin count
+	_, maxAdmins := groupLimits(groupType)
+	previousOwnerRole := RoleAdmin
+	if newOwnerRole != RoleAdmin && adminCount+1 > maxAdmins {
+		previousOwnerRole = RoleMember
+	}
+
+	// Demote first: a group can only have one owner at a time
+	query = `UPDATE group_members SET role = $1 WHERE group_id = $2 AND member_id = $3`
+	if _, err := tx.Exec(query, previousOwnerRole, groupID, int(userIDInt)); err != nil {
+		log.Printf("Error demoting previous owner: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+	if _, err := tx.Exec(query, RoleOwner, groupID, req.NewOwnerID); err != nil {
+		log.Printf("Error promoting new owner: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+
+	details := map[string]interface{}{
+		"previous_owner_role":     previousOwnerRole,
+		"new_owner_previous_role": newOwnerRole,
+	}
+	if err := recordGroupEventTx(tx, groupID, int(userIDInt), EventOwnershipTransferred, req.NewOwnerID, details); err != nil {
+		log.Printf("Error recording group event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Ownership transferred",
+		"owner_id":            req.NewOwnerID,
+		"previous_owner_role": previousOwnerRole,
+	})
+}
+
+// DeleteGroupHandler permanently deletes a group with its members and messages (owner only)
+func DeleteGroupHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermDeleteGroup)
+	if !ok {
+		return
+	}
+
+	// Messages under a legal hold must be preserved, including those of members on hold
+	held, err := groupUnderLegalHold(groupID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+	if held {
+		c.JSON(http.StatusConflict, gin.H{"error": "Messages in this group are under a legal hold, so it can't be deleted"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+	defer tx.Rollback()
+
+	var groupName string
+	var memberCount int
+	query := `SELECT group_name, member_count FROM groups WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(query, groupID).Scan(&groupName, &memberCount); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+
+	// The audit trail outlives the group
+	details := map[string]interface{}{
+		"group_name":   groupName,
+		"member_count": memberCount,
+	}
+	if err := recordGroupEventTx(tx, groupID, int(userIDInt), EventGroupDeleted, 0, details); err != nil {
+		log.Printf("Error recording group event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+
+	// Messages and members reference the group without ON DELETE CASCADE
+	for _, query := range []string{
+		`DELETE FROM messages WHERE group_id = $1`,
+		`DELETE FROM group_members WHERE group_id = $1`,
+		`DELETE FROM groups WHERE id = $1`,
+	} {
+		if _, err := tx.Exec(query, groupID); err != nil {
+			log.Printf("Error deleting group: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+			return
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted"})
+}
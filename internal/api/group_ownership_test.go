@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeleteGroupKeepsMessagesOfUsersOnHold(t *testing.T) {
+	requireDatabase(t)
+
+	ownerID := createTestUser(t)
+	memberID := createTestUser(t)
+	groupID := createTestGroup(t, ownerID, memberID)
+	params := gin.Params{{Key: "group_id", Value: strconv.Itoa(groupID)}}
+
+	var messageID int
+	query := `INSERT INTO messages (sender_id, group_id, content) VALUES ($1, $2, 'Evidence') RETURNING id`
+	if err := db.GetDB().QueryRow(query, memberID, groupID).Scan(&messageID); err != nil {
+		t.Fatalf("sending message: %v", err)
+	}
+
+	// A hold on the member, not the group, still keeps their group messages
+	var holdID int
+	query = `INSERT INTO legal_holds (user_id, reason) VALUES ($1, 'Test hold') RETURNING id`
+	if err := db.GetDB().QueryRow(query, memberID).Scan(&holdID); err != nil {
+		t.Fatalf("creating hold: %v", err)
+	}
+
+	if w := serveAs(DeleteGroupHandler, http.MethodDelete, ownerID, params); w.Code != http.StatusConflict {
+		t.Fatalf("delete with a member on hold returned %d, want 409: %s", w.Code, w.Body)
+	}
+	var kept bool
+	query = `SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1)`
+	if err := db.GetDB().QueryRow(query, messageID).Scan(&kept); err != nil || !kept {
+		t.Fatalf("held message was deleted (err %v)", err)
+	}
+
+	// Once the hold is released the group can go
+	query = `UPDATE legal_holds SET released_at = NOW() WHERE id = $1`
+	if _, err := db.GetDB().Exec(query, holdID); err != nil {
+		t.Fatalf("releasing hold: %v", err)
+	}
+	if w := serveAs(DeleteGroupHandler, http.MethodDelete, ownerID, params); w.Code != http.StatusOK {
+		t.Fatalf("delete after the release returned %d, want 200: %s", w.Code, w.Body)
+	}
+	var exists bool
+	query = `SELECT EXISTS(SELECT 1 FROM groups WHERE id = $1)`
+	if err := db.GetDB().QueryRow(query, groupID).Scan(&exists); err != nil || exists {
+		t.Fatalf("group still exists after delete (err %v)", err)
+	}
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Group member roles, from most to least privileged
+const (
+	RoleOwner     = "owner"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+	RoleReadOnly  = "read_only"
+)
+
+// GroupPermission is an action a member may be allowed to perform in a group
+type GroupPermission string
+
+// Group permissions
+const (
+	PermViewGroup     GroupPermission = "view_group"
+	PermPost          GroupPermission = "post"
+	PermAddMembers    GroupPermission = "add_members"
+	PermRemoveMembers GroupPermission = "remove_members"
+	PermEditInfo      GroupPermission = "edit_info"
+	PermPin           GroupPermission = "pin"
+	PermManageRoles   GroupPermission = "manage_roles"
+	PermTransferOwner GroupPermission = "transfer_ownership"
+	PermDeleteGroup   GroupPermission = "delete_group"
+	PermViewAuditLog  GroupPermission = "view_audit_log"
+	PermClosePolls    GroupPermission = "close_polls"
+)
+
+// roleRank orders roles; members can only act on members ranked below them
+var roleRank = map[string]int{
+	RoleOwner:     4,
+	RoleAdmin:     3,
+	RoleModerator: 2,
+	RoleMember:    1,
+	RoleReadOnly:  0,
+}
+
+// rolePermissions is the permission matrix for group roles
+var rolePermissions = map[string][]GroupPermission{
+	RoleOwner: {PermViewGroup, PermPost, PermAddMembers, PermRemoveMembers, PermEditInfo, PermPin, PermManageRoles,
+		PermViewAuditLog, PermClosePolls, PermTransferOwner, PermDeleteGroup},
+	RoleAdmin: {PermViewGroup, PermPost, PermAddMembers, PermRemoveMembers, PermEditInfo, PermPin, PermManageRoles,
+		PermViewAuditLog, PermClosePolls},
+	RoleModerator: {PermViewGroup, PermPost, PermRemoveMembers, PermPin, PermClosePolls},
+	RoleMember:    {PermViewGroup, PermPost},
+	RoleReadOnly:  {PermViewGroup},
+}
+
+// channelAdminPermissions are withheld from everyone but owners and admins in channels,
+// which are one-to-many: admins broadcast and everyone else reads
+var channelAdminPermissions = map[GroupPermission]string{
+	PermPost: "Only admins can post in this channel",
+}
+
+// permissionActions describes each permission for error messages
+var permissionActions = map[GroupPermission]string{
+	PermViewGroup:     "view this group",
+	PermPost:          "post in this group",
+	PermAddMembers:    "add members to this group",
+	PermRemoveMembers: "remove members from this group",
+	PermEditInfo:      "edit this group",
+	PermPin:           "pin messages in this group",
+	PermManageRoles:   "change member roles in this group",
+	PermTransferOwner: "transfer ownership of this group",
+	PermDeleteGroup:   "delete this group",
+	PermViewAuditLog:  "view the audit log of this group",
+	PermClosePolls:    "close other members' polls in this group",
+}
+
+// UpdateRoleRequest defines the structure for changing a member's role
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin moderator member read_only"`
+}
+
+// roleHasPermission reports whether the role grants the permission
+func roleHasPermission(role string, perm GroupPermission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeGroupAction checks that userID is a member of the group whose role grants perm.
+// It returns the member's role, or a ForbiddenError when the action isn't allowed.
+func authorizeGroupAction(groupID, userID int, perm GroupPermission) (string, error) {
+	var role, groupType string
+	query := `SELECT gm.role, g.group_type
+		FROM group_members gm
+		INNER JOIN groups g ON g.id = gm.group_id
+		WHERE gm.group_id = $1 AND gm.member_id = $2`
+	err := db.GetDB().QueryRow(query, groupID, userID).Scan(&role, &groupType)
+	if err == sql.ErrNoRows {
+		return "", &ForbiddenError{"You are not a member of this group"}
+	}
+	if err != nil {
+		return "", err
+	}
+	if !roleHasPermission(role, perm) {
+		return role, &ForbiddenError{fmt.Sprintf("Your role (%s) does not allow you to %s", role, permissionActions[perm])}
+	}
+	if msg, restricted := channelAdminPermissions[perm]; restricted && groupType == GroupTypeChannel &&
+		role != RoleOwner && role != RoleAdmin {
+		return role, &ForbiddenError{msg}
+	}
+	return role, nil
+}
+
+// groupActionParam parses the :group_id URL parameter and authorizes the caller for perm
+func groupActionParam(c *gin.Context, userID int, perm GroupPermission) (int, string, bool) {
+	groupID, err := strconv.Atoi(c.Param("group_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return 0, "", false
+	}
+
+	role, err := authorizeGroupAction(groupID, userID, perm)
+	if err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return 0, "", false
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify group membership"})
+		return 0, "", false
+	}
+	return groupID, role, true
+}
+
+// canAssignRole reports whether a member with actorRole may give someone the role.
+// Nobody can hand out ownership, and roles above the actor's own are off limits.
+func canAssignRole(actorRole, role string) bool {
+	return role != RoleOwner && roleRank[role] <= roleRank[actorRole]
+}
+
+// UpdateMemberRoleHandler changes the role of a group member
+func UpdateMemberRoleHandler(c *gin.Context) {
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of: admin, moderator, member, read_only"})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, actorRole, ok := groupActionParam(c, int(userIDInt), PermManageRoles)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.Atoi(c.Param("member_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid member ID"})
+		return
+	}
+	if memberID == int(userIDInt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own role"})
+		return
+	}
+	if !canAssignRole(actorRole, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot assign a role above your own"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the group so concurrent promotions can't exceed the admin limit
+	groupType, _, err := lockGroupTx(tx, groupID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	_, maxAdmins := groupLimits(groupType)
+
+	var currentRole string
+	query := `SELECT role FROM group_members WHERE group_id = $1 AND member_id = $2`
+	if err := tx.QueryRow(query, groupID, memberID).Scan(&currentRole); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this group"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	if roleRank[currentRole] >= roleRank[actorRole] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only change the role of members ranked below you"})
+		return
+	}
+
+	if req.Role == RoleAdmin && currentRole != RoleAdmin {
+		var adminCount int
+		query = `SELECT COUNT(*) FROM group_members WHERE group_id = $1 AND is_admin = true`
+		if err := tx.QueryRow(query, groupID).Scan(&adminCount); err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+			return
+		}
+		if adminCount >= maxAdmins {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Group has reached maximum admin limit of %d", maxAdmins),
+			})
+			return
+		}
+	}
+
+	query = `UPDATE group_members SET role = $1 WHERE group_id = $2 AND member_id = $3`
+	if _, err := tx.Exec(query, req.Role, groupID, memberID); err != nil {
+		log.Printf("Error updating role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	details := map[string]interface{}{"old_role": currentRole, "new_role": req.Role}
+	if err := recordGroupEventTx(tx, groupID, int(userIDInt), EventRoleChanged, memberID, details); err != nil {
+		log.Printf("Error recording group event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Role updated",
+		"member_id": memberID,
+		"role":      req.Role,
+	})
+}
@@ -1,9 +1,14 @@
 package api
 
 import (
+	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"messaging-system/pkg/db"
 
@@ -12,21 +17,36 @@ import (
 
 // CreateGroupRequest defines the structure for creating a group
 type CreateGroupRequest struct {
-	GroupName string `json:"group_name" binding:"required"`
+	GroupName  string `json:"group_name" binding:"required"`
+	GroupType  string `json:"group_type,omitempty" binding:"omitempty,oneof=group channel"`
+	JoinPolicy string `json:"join_policy,omitempty" binding:"omitempty,oneof=invite_only request open"`
 }
 
-// AddMemberRequest defines the structure for adding a member to a group
+// AddMemberRequest defines the structure for adding a member to a group.
+// Role defaults to member; is_admin is kept for older clients and means role "admin".
 type AddMemberRequest struct {
-	MemberID int  `json:"member_id" binding:"required"`
-	IsAdmin  bool `json:"is_admin,omitempty"`
+	MemberID int    `json:"member_id" binding:"required"`
+	IsAdmin  bool   `json:"is_admin,omitempty"`
+	Role     string `json:"role,omitempty" binding:"omitempty,oneof=admin moderator member read_only"`
+}
+
+// UpdateGroupRequest defines the structure for editing group info
+type UpdateGroupRequest struct {
+	GroupName string `json:"group_name" binding:"required"`
 }
 
 // Group represents a group in the system
 type Group struct {
-	ID        int       `json:"id"`
-	GroupName string    `json:"group_name"`
-	CreatorID int       `json:"creator_id"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                int       `json:"id"`
+	GroupName         string    `json:"group_name"`
+	GroupType         string    `json:"group_type"`
+	CreatorID         int       `json:"creator_id"` // Who created the group; ownership may since have moved
+	OwnerID           int       `json:"owner_id"`
+	JoinPolicy        string    `json:"join_policy"`
+	MemberCount       int       `json:"member_count"`
+	MessageTTLSeconds *int      `json:"message_ttl_seconds"` // Disappearing message timer, nil when off
+	Role              string    `json:"role,omitempty"`      // The current user's role in the group
+	CreatedAt         time.Time `json:"created_at"`
 }
 
 // GroupMember represents a group member
@@ -34,10 +54,84 @@ type GroupMember struct {
 	ID       int       `json:"id"`
 	GroupID  int       `json:"group_id"`
 	MemberID int       `json:"member_id"`
+	Role     string    `json:"role"`
 	IsAdmin  bool      `json:"is_admin"`
 	JoinedAt time.Time `json:"joined_at"`
 }
 
+// Group types
+const (
+	GroupTypeGroup   = "group"
+	GroupTypeChannel = "channel"
+)
+
+// Group limits
+const (
+	maxGroupMembers    = 25
+	maxGroupAdmins     = 2
+	maxGroupNameLength = 100
+)
+
+// groupLimits returns the member and admin limits for a group type. Channels are
+// one-to-many, so their limits are much higher and configurable.
+func groupLimits(groupType string) (maxMembers, maxAdmins int) {
+	if groupType == GroupTypeChannel {
+		return getEnvInt("CHANNEL_MAX_MEMBERS", 100000), getEnvInt("CHANNEL_MAX_ADMINS", 10)
+	}
+	return maxGroupMembers, maxGroupAdmins
+}
+
+// lockGroupTx locks a group row for the rest of tx and returns its type and member count
+func lockGroupTx(tx *sql.Tx, groupID int) (groupType string, memberCount int, err error) {
+	query := `SELECT group_type, member_count FROM groups WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRow(query, groupID).Scan(&groupType, &memberCount)
+	if err == sql.ErrNoRows {
+		return "", 0, &ValidationError{"Group does not exist"}
+	}
+	return groupType, memberCount, err
+}
+
+// addMemberTx adds a user to a group inside tx. The group row is locked first so
+// concurrent adds and invite joins can't push the group past its limits.
+func addMemberTx(tx *sql.Tx, groupID, memberID int, role string) error {
+	groupType, memberCount, err := lockGroupTx(tx, groupID)
+	if err != nil {
+		return err
+	}
+	maxMembers, maxAdmins := groupLimits(groupType)
+
+	var alreadyMember bool
+	var adminCount int
+	query := `
+		SELECT
+			EXISTS(SELECT 1 FROM group_members WHERE group_id = $1 AND member_id = $2),
+			(SELECT COUNT(*) FROM group_members WHERE group_id = $1 AND is_admin = true)`
+	err = tx.QueryRow(query, groupID, memberID).Scan(&alreadyMember, &adminCount)
+	if err != nil {
+		return err
+	}
+	if alreadyMember {
+		return &ConflictError{"User is already a member of this group"}
+	}
+	if memberCount >= maxMembers {
+		return &ValidationError{fmt.Sprintf("Group has reached maximum member limit of %d", maxMembers)}
+	}
+	if role == RoleAdmin && adminCount >= maxAdmins {
+		return &ValidationError{fmt.Sprintf("Group has reached maximum admin limit of %d", maxAdmins)}
+	}
+
+	query = `INSERT INTO group_members (group_id, member_id, role) VALUES ($1, $2, $3)`
+	if _, err = tx.Exec(query, groupID, memberID, role); err != nil {
+		return err
+	}
+
+	// However they got in, the new member's pending join request is settled
+	query = `UPDATE group_join_requests SET status = 'approved', decided_at = NOW()
+		WHERE group_id = $1 AND user_id = $2 AND status = 'pending'`
+	_, err = tx.Exec(query, groupID, memberID)
+	return err
+}
+
 // CreateGroupHandler handles creating a new group
 func CreateGroupHandler(c *gin.Context) {
 	var req CreateGroupRequest
@@ -68,18 +162,25 @@ func CreateGroupHandler(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
+	if req.GroupType == "" {
+		req.GroupType = GroupTypeGroup
+	}
+	if req.JoinPolicy == "" {
+		req.JoinPolicy = JoinPolicyInviteOnly
+	}
+
 	// Create the group
 	var groupID int
-	query := `INSERT INTO groups (group_name, creator_id) VALUES ($1, $2) RETURNING id`
-	err = tx.QueryRow(query, req.GroupName, int(creatorIDInt)).Scan(&groupID)
+	query := `INSERT INTO groups (group_name, group_type, creator_id, join_policy) VALUES ($1, $2, $3, $4) RETURNING id`
+	err = tx.QueryRow(query, req.GroupName, req.GroupType, int(creatorIDInt), req.JoinPolicy).Scan(&groupID)
 	if err != nil {
 		log.Printf("Error creating group: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
 		return
 	}
 
-	// Add creator as admin member
-	query = `INSERT INTO group_members (group_id, member_id, is_admin) VALUES ($1, $2, true)`
+	// Add creator as the group owner
+	query = `INSERT INTO group_members (group_id, member_id, role) VALUES ($1, $2, 'owner')`
 	_, err = tx.Exec(query, groupID, int(creatorIDInt))
 	if err != nil {
 		log.Printf("Error adding creator as admin: %v", err)
@@ -87,6 +188,13 @@ func CreateGroupHandler(c *gin.Context) {
 		return
 	}
 
+	details := map[string]interface{}{"group_name": req.GroupName, "group_type": req.GroupType}
+	if err := recordGroupEventTx(tx, groupID, int(creatorIDInt), EventGroupCreated, 0, details); err != nil {
+		log.Printf("Error recording group event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
 		log.Printf("Error committing transaction: %v", err)
@@ -122,28 +230,39 @@ func AddMemberToGroupHandler(c *gin.Context) {
 	}
 
 	// Get group ID from URL parameter
-	groupID := c.Param("group_id")
-	if groupID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Group ID parameter is required"})
+	groupID, err := strconv.Atoi(c.Param("group_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
 		return
 	}
 
-	// Check if requester is an admin of the group
-	var isAdmin bool
-	query := `SELECT is_admin FROM group_members WHERE group_id = $1 AND member_id = $2`
-	err := db.GetDB().QueryRow(query, groupID, int(requesterIDInt)).Scan(&isAdmin)
+	// Check the requester may add members, and may hand out the requested role
+	requesterRole, err := authorizeGroupAction(groupID, int(requesterIDInt), PermAddMembers)
 	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group or do not have permission"})
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify group membership"})
 		return
 	}
-	if !isAdmin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can add members to the group"})
+
+	role := req.Role
+	if role == "" {
+		role = RoleMember
+		if req.IsAdmin {
+			role = RoleAdmin
+		}
+	}
+	if role != RoleMember && (!roleHasPermission(requesterRole, PermManageRoles) || !canAssignRole(requesterRole, role)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot add members with this role"})
 		return
 	}
 
 	// Check if user to be added exists
 	var userExists bool
-	query = `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`
 	err = db.GetDB().QueryRow(query, req.MemberID).Scan(&userExists)
 	if err != nil {
 		log.Printf("Database error: %v", err)
@@ -155,55 +274,47 @@ func AddMemberToGroupHandler(c *gin.Context) {
 		return
 	}
 
-	// Check if user is already a member
-	var alreadyMember bool
-	query = `SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = $1 AND member_id = $2)`
-	err = db.GetDB().QueryRow(query, groupID, req.MemberID).Scan(&alreadyMember)
-	if err != nil {
+	// Enforce blocks and the new member's privacy setting
+	if err := checkUserInteraction(int(requesterIDInt), req.MemberID, "add them to groups"); err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		log.Printf("Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check membership"})
-		return
-	}
-	if alreadyMember {
-		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of this group"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify user"})
 		return
 	}
 
-	// Check group constraints before adding
-	var memberCount int
-	query = `SELECT COUNT(*) FROM group_members WHERE group_id = $1`
-	err = db.GetDB().QueryRow(query, groupID).Scan(&memberCount)
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
 	if err != nil {
-		log.Printf("Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group constraints"})
-		return
-	}
-	if memberCount >= 25 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Group has reached maximum member limit of 25"})
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member to group"})
 		return
 	}
+	defer tx.Rollback()
 
-	// If trying to add as admin, check admin count
-	if req.IsAdmin {
-		var adminCount int
-		query = `SELECT COUNT(*) FROM group_members WHERE group_id = $1 AND is_admin = true`
-		err = db.GetDB().QueryRow(query, groupID).Scan(&adminCount)
-		if err != nil {
-			log.Printf("Database error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check admin constraints"})
-			return
-		}
-		if adminCount >= 2 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Group has reached maximum admin limit of 2"})
+	// Add the member, enforcing group limits
+	if err := addMemberTx(tx, groupID, req.MemberID, role); err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
 			return
 		}
+		log.Printf("Error adding member to group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member to group"})
+		return
 	}
 
-	// Add the member
-	query = `INSERT INTO group_members (group_id, member_id, is_admin) VALUES ($1, $2, $3)`
-	_, err = db.GetDB().Exec(query, groupID, req.MemberID, req.IsAdmin)
-	if err != nil {
-		log.Printf("Error adding member to group: %v", err)
+	details := map[string]interface{}{"role": role}
+	if err := recordGroupEventTx(tx, groupID, int(requesterIDInt), EventMemberAdded, req.MemberID, details); err != nil {
+		log.Printf("Error recording group event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member to group"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member to group"})
 		return
 	}
@@ -228,7 +339,9 @@ func GetUserGroupsHandler(c *gin.Context) {
 
 	// Query to get all groups user is a member of
 	query := `
-		SELECT g.id, g.group_name, g.creator_id, g.created_at
+		SELECT g.id, g.group_name, g.group_type, g.creator_id,
+		       (SELECT o.member_id FROM group_members o WHERE o.group_id = g.id AND o.role = 'owner'),
+		       g.join_policy, g.member_count, g.message_ttl_seconds, gm.role, g.created_at
 		FROM groups g
 		INNER JOIN group_members gm ON g.id = gm.group_id
 		WHERE gm.member_id = $1
@@ -245,7 +358,8 @@ func GetUserGroupsHandler(c *gin.Context) {
 	var groups []Group
 	for rows.Next() {
 		var group Group
-		err := rows.Scan(&group.ID, &group.GroupName, &group.CreatorID, &group.CreatedAt)
+		err := rows.Scan(&group.ID, &group.GroupName, &group.GroupType, &group.CreatorID, &group.OwnerID,
+			&group.JoinPolicy, &group.MemberCount, &group.MessageTTLSeconds, &group.Role, &group.CreatedAt)
 		if err != nil {
 			log.Printf("Error scanning group: %v", err)
 			continue
@@ -271,34 +385,19 @@ func GetGroupMembersHandler(c *gin.Context) {
 		return
 	}
 
-	// Get group ID from URL parameter
-	groupID := c.Param("group_id")
-	if groupID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Group ID parameter is required"})
-		return
-	}
-
 	// Check if user is a member of the group
-	var isMember bool
-	query := `SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = $1 AND member_id = $2)`
-	err := db.GetDB().QueryRow(query, groupID, int(userIDInt)).Scan(&isMember)
-	if err != nil {
-		log.Printf("Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify group membership"})
-		return
-	}
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermViewGroup)
+	if !ok {
 		return
 	}
 
 	// Query to get all members of the group
-	query = `
-		SELECT gm.id, gm.group_id, gm.member_id, gm.is_admin, gm.joined_at, u.username
+	query := `
+		SELECT gm.id, gm.group_id, gm.member_id, gm.role, gm.is_admin, gm.joined_at, u.username, u.display_name, u.avatar_url
 		FROM group_members gm
 		INNER JOIN users u ON gm.member_id = u.id
 		WHERE gm.group_id = $1
-		ORDER BY gm.is_admin DESC, gm.joined_at ASC`
+		ORDER BY array_position(ARRAY['owner', 'admin', 'moderator', 'member', 'read_only']::varchar[], gm.role), gm.joined_at ASC`
 
 	rows, err := db.GetDB().Query(query, groupID)
 	if err != nil {
@@ -312,22 +411,207 @@ func GetGroupMembersHandler(c *gin.Context) {
 	for rows.Next() {
 		var member GroupMember
 		var username string
-		err := rows.Scan(&member.ID, &member.GroupID, &member.MemberID, &member.IsAdmin, &member.JoinedAt, &username)
+		var displayName, avatarURL *string
+		err := rows.Scan(&member.ID, &member.GroupID, &member.MemberID, &member.Role, &member.IsAdmin, &member.JoinedAt,
+			&username, &displayName, &avatarURL)
 		if err != nil {
 			log.Printf("Error scanning member: %v", err)
 			continue
 		}
 
 		memberData := map[string]interface{}{
-			"id":        member.ID,
-			"group_id":  member.GroupID,
-			"member_id": member.MemberID,
-			"username":  username,
-			"is_admin":  member.IsAdmin,
-			"joined_at": member.JoinedAt,
+			"id":           member.ID,
+			"group_id":     member.GroupID,
+			"member_id":    member.MemberID,
+			"username":     username,
+			"display_name": displayName,
+			"avatar_url":   avatarURL,
+			"role":         member.Role,
+			"is_admin":     member.IsAdmin,
+			"joined_at":    member.JoinedAt,
 		}
 		members = append(members, memberData)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"members": members})
 }
+
+// UpdateGroupHandler edits a group's info
+func UpdateGroupHandler(c *gin.Context) {
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermEditInfo)
+	if !ok {
+		return
+	}
+
+	groupName := strings.TrimSpace(req.GroupName)
+	if groupName == "" || utf8.RuneCountInString(groupName) > maxGroupNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("group_name must be between 1 and %d characters", maxGroupNameLength),
+		})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	query := `SELECT group_name FROM groups WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(query, groupID).Scan(&oldName); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+
+	if oldName != groupName {
+		query = `UPDATE groups SET group_name = $1 WHERE id = $2`
+		if _, err := tx.Exec(query, groupName, groupID); err != nil {
+			log.Printf("Error updating group: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+			return
+		}
+
+		details := map[string]interface{}{"old_name": oldName, "new_name": groupName}
+		if err := recordGroupEventTx(tx, groupID, int(userIDInt), EventGroupRenamed, 0, details); err != nil {
+			log.Printf("Error recording group event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+			return
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Group updated successfully",
+		"group_name": groupName,
+	})
+}
+
+// RemoveGroupMemberHandler removes a member from a group. Members can remove themselves
+// (leave); removing someone else needs the remove_members permission and a higher rank.
+// The owner can only leave by transferring ownership first.
+func RemoveGroupMemberHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	memberID, err := strconv.Atoi(c.Param("member_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid member ID"})
+		return
+	}
+
+	// Leaving only requires membership
+	perm := PermRemoveMembers
+	if memberID == int(userIDInt) {
+		perm = PermViewGroup
+	}
+	groupID, actorRole, ok := groupActionParam(c, int(userIDInt), perm)
+	if !ok {
+		return
+	}
+
+	var memberRole string
+	query := `SELECT role FROM group_members WHERE group_id = $1 AND member_id = $2`
+	if err := db.GetDB().QueryRow(query, groupID, memberID).Scan(&memberRole); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this group"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	if memberRole == RoleOwner {
+		if memberID == int(userIDInt) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Transfer ownership to another member before leaving the group"})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "The group owner cannot be removed"})
+		return
+	}
+	if memberID != int(userIDInt) && roleRank[memberRole] >= roleRank[actorRole] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only remove members ranked below you"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	defer tx.Rollback()
+
+	query = `DELETE FROM group_members WHERE group_id = $1 AND member_id = $2`
+	result, err := tx.Exec(query, groupID, memberID)
+	if err != nil {
+		log.Printf("Error removing member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this group"})
+		return
+	}
+
+	eventType, target := EventMemberRemoved, memberID
+	if memberID == int(userIDInt) {
+		eventType, target = EventMemberLeft, 0
+	}
+	details := map[string]interface{}{"role": memberRole}
+	if err := recordGroupEventTx(tx, groupID, int(userIDInt), eventType, target, details); err != nil {
+		log.Printf("Error recording group event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed from group"})
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxClientMessageIDLength matches the client_message_id columns
+const maxClientMessageIDLength = 64
+
+// errDuplicateClientMessage is returned when a message with the same client_message_id
+// was stored concurrently; the caller responds with the original instead
+var errDuplicateClientMessage = errors.New("duplicate client_message_id")
+
+// SentMessage identifies a stored message in send responses
+type SentMessage struct {
+	ID        int       `json:"message_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// nullableClientMessageID stores an empty client_message_id as NULL
+func nullableClientMessageID(clientMessageID string) sql.NullString {
+	return sql.NullString{String: clientMessageID, Valid: clientMessageID != ""}
+}
+
+// scanSentMessage reads the RETURNING id, created_at row of a message insert that
+// skips duplicate client_message_ids
+func scanSentMessage(row *sql.Row) (SentMessage, error) {
+	var sent SentMessage
+	err := row.Scan(&sent.ID, &sent.CreatedAt)
+	if err == sql.ErrNoRows {
+		return sent, errDuplicateClientMessage
+	}
+	return sent, err
+}
+
+// clientMessageIDParam reads the optional idempotency key from the request body's
+// client_message_id or the Idempotency-Key header. Both may be given if they match.
+func clientMessageIDParam(c *gin.Context, req SendMessageRequest) (string, bool) {
+	key := strings.TrimSpace(req.ClientMessageID)
+	header := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+	if key == "" {
+		key = header
+	} else if header != "" && header != key {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client_message_id and Idempotency-Key don't match"})
+		return "", false
+	}
+
+	if len(key) > maxClientMessageIDLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("client_message_id must be at most %d characters", maxClientMessageIDLength),
+		})
+		return "", false
+	}
+	return key, true
+}
+
+// sameTarget reports whether a stored message went where the request is sending
+func sameTarget(receiverID, groupID sql.NullInt64, req SendMessageRequest) bool {
+	if req.ReceiverID != nil {
+		return receiverID.Valid && receiverID.Int64 == int64(*req.ReceiverID)
+	}
+	return groupID.Valid && groupID.Int64 == int64(*req.GroupID)
+}
+
+// sameMessage reports whether a stored message matches the one being sent
+func sameMessage(receiverID, groupID sql.NullInt64, content, messageType string, req SendMessageRequest, msg outgoingMessage) bool {
+	return content == msg.content && messageType == msg.messageType && sameTarget(receiverID, groupID, req)
+}
+
+// respondWithOriginalMessage answers a retry with the message already stored under the
+// sender's client_message_id. It reports false when there is no such message yet.
+func respondWithOriginalMessage(c *gin.Context, senderID int, req SendMessageRequest, msg outgoingMessage) bool {
+	var original SentMessage
+	var receiverID, groupID sql.NullInt64
+	var content, messageType string
+	query := `SELECT id, receiver_id, group_id, content, message_type, created_at
+		FROM messages
+		WHERE sender_id = $1 AND client_message_id = $2`
+	err := db.GetDB().QueryRow(query, senderID, msg.clientMessageID).
+		Scan(&original.ID, &receiverID, &groupID, &content, &messageType, &original.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return true
+	}
+
+	// Reusing an ID for a different message is a client bug, not a retry
+	if !sameMessage(receiverID, groupID, content, messageType, req, msg) {
+		c.JSON(http.StatusConflict, gin.H{"error": "client_message_id was already used for a different message"})
+		return true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Message already sent",
+		"message_id":        original.ID,
+		"created_at":        original.CreatedAt,
+		"client_message_id": msg.clientMessageID,
+		"duplicate":         true,
+	})
+	return true
+}
+
+// respondWithOriginalSchedule is respondWithOriginalMessage for scheduled messages
+func respondWithOriginalSchedule(c *gin.Context, senderID int, req SendMessageRequest, msg outgoingMessage) bool {
+	var scheduledID int
+	var receiverID, groupID sql.NullInt64
+	var content, messageType string
+	var sendAt time.Time
+	query := `SELECT id, receiver_id, group_id, content, message_type, send_at
+		FROM scheduled_messages
+		WHERE sender_id = $1 AND client_message_id = $2`
+	err := db.GetDB().QueryRow(query, senderID, msg.clientMessageID).
+		Scan(&scheduledID, &receiverID, &groupID, &content, &messageType, &sendAt)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule message"})
+		return true
+	}
+
+	if !sameMessage(receiverID, groupID, content, messageType, req, msg) {
+		c.JSON(http.StatusConflict, gin.H{"error": "client_message_id was already used for a different message"})
+		return true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":              "Message already scheduled",
+		"scheduled_message_id": scheduledID,
+		"send_at":              sendAt,
+		"client_message_id":    msg.clientMessageID,
+		"duplicate":            true,
+	})
+	return true
+}
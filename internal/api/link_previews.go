@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"messaging-system/internal/richtext"
+	"messaging-system/internal/unfurl"
+	"messaging-system/pkg/db"
+)
+
+// linkPreviewBatch is the most messages the link previewer claims at once
+const linkPreviewBatch = 20
+
+// maxPreviewURLLength is the longest URL that gets a preview
+const maxPreviewURLLength = 2048
+
+// failedLinkPreviewTTL is how long a failed fetch is remembered before the URL is tried again
+const failedLinkPreviewTTL = time.Hour
+
+var (
+	linkPreviewer *unfurl.Fetcher
+	// linkPreviewWakeup lets senders start the previewer right away instead of at the next tick
+	linkPreviewWakeup = make(chan struct{}, 1)
+)
+
+// linkPreviewsEnabled reports whether new messages get link previews
+func linkPreviewsEnabled() bool {
+	return getEnvBool("LINK_PREVIEWS_ENABLED", true)
+}
+
+// previewLink returns the link in content that gets a preview: the first http(s) URL
+func previewLink(content string) string {
+	for _, link := range richtext.Links(content) {
+		if len(link) <= maxPreviewURLLength {
+			return link
+		}
+	}
+	return ""
+}
+
+// wantsLinkPreview reports whether a new message should be queued for a link preview
+func wantsLinkPreview(msg outgoingMessage) bool {
+	if msg.linkPreview != nil || (msg.messageType != MessageTypeText && msg.messageType != MessageTypeMarkdown) {
+		return false
+	}
+	return linkPreviewsEnabled() && previewLink(msg.content) != ""
+}
+
+// wakeLinkPreviewer nudges the previewer after a message with a link is stored
+func wakeLinkPreviewer() {
+	select {
+	case linkPreviewWakeup <- struct{}{}:
+	default:
+		// A wakeup is already pending
+	}
+}
+
+// StartLinkPreviewer starts the background worker that attaches link previews to new
+// messages. Pages are fetched by the server, so clients don't reveal their IP addresses
+// to every site linked in a conversation.
+func StartLinkPreviewer() {
+	if !linkPreviewsEnabled() {
+		log.Printf("Link previews disabled")
+		return
+	}
+
+	linkPreviewer = unfurl.New(unfurl.Options{
+		Timeout:  getEnvDuration("LINK_PREVIEW_TIMEOUT", 5*time.Second),
+		MaxBytes: int64(getEnvInt("LINK_PREVIEW_MAX_BYTES", 512*1024)),
+	})
+
+	interval := getEnvDuration("LINK_PREVIEW_INTERVAL", 30*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pruneLinkPreviewCache()
+			case <-linkPreviewWakeup:
+			}
+			generateLinkPreviews()
+		}
+	}()
+	log.Printf("Link previewer started (every %s)", interval)
+}
+
+// linkPreviewJob is a message waiting for its link preview
+type linkPreviewJob struct {
+	messageID int
+	content   string
+}
+
+// generateLinkPreviews works through the queued messages batch by batch
+func generateLinkPreviews() {
+	for {
+		jobs, err := claimLinkPreviewJobs()
+		if err != nil {
+			log.Printf("Error claiming link preview jobs: %v", err)
+			return
+		}
+		for _, job := range jobs {
+			attachLinkPreview(job)
+		}
+		if len(jobs) < linkPreviewBatch {
+			return
+		}
+	}
+}
+
+// claimLinkPreviewJobs takes queued messages off the queue. Previews are best effort:
+// a message whose fetch fails, or is cut short by a restart, just has none.
+func claimLinkPreviewJobs() ([]linkPreviewJob, error) {
+	query := `UPDATE messages SET link_preview_pending = false
+		WHERE id IN (
+			SELECT id FROM messages
+			WHERE link_preview_pending
+			ORDER BY id
+			LIMIT $1
+			FOR NO KEY UPDATE SKIP LOCKED)
+		RETURNING id, content`
+	rows, err := db.GetDB().Query(query, linkPreviewBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []linkPreviewJob
+	for rows.Next() {
+		var job linkPreviewJob
+		if err := rows.Scan(&job.messageID, &job.content); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// attachLinkPreview fetches (or reuses) the preview of a message's link and stores it on the message
+func attachLinkPreview(job linkPreviewJob) {
+	link := previewLink(job.content)
+	if link == "" {
+		return
+	}
+
+	preview, err := cachedLinkPreview(link)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		return
+	}
+	if preview == nil {
+		return
+	}
+
+	query := `UPDATE messages SET link_preview = $1 WHERE id = $2`
+	if _, err := db.GetDB().Exec(query, preview, job.messageID); err != nil {
+		log.Printf("Error attaching link preview: %v", err)
+	}
+}
+
+// cachedLinkPreview returns the preview JSON of a URL, fetching it unless a recent
+// result is cached. It returns nil when the page has no preview.
+func cachedLinkPreview(link string) ([]byte, error) {
+	var preview []byte
+	var fetchedAt time.Time
+	query := `SELECT preview, fetched_at FROM link_previews WHERE url = $1`
+	err := db.GetDB().QueryRow(query, link).Scan(&preview, &fetchedAt)
+	if err == nil {
+		ttl := linkPreviewCacheTTL()
+		if preview == nil {
+			ttl = failedLinkPreviewTTL
+		}
+		if time.Since(fetchedAt) < ttl {
+			return preview, nil
+		}
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	preview = nil
+	result, err := linkPreviewer.Fetch(context.Background(), link)
+	if err != nil {
+		log.Printf("Error fetching link preview: %v", err)
+	} else if result.Title != "" || result.Description != "" || result.ImageURL != "" {
+		preview, _ = json.Marshal(result)
+	}
+
+	query = `INSERT INTO link_previews (url, preview, fetched_at) VALUES ($1, $2, $3)
+		ON CONFLICT (url) DO UPDATE SET preview = EXCLUDED.preview, fetched_at = EXCLUDED.fetched_at`
+	if _, err := db.GetDB().Exec(query, link, nullableJSON(preview), time.Now()); err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// linkPreviewCacheTTL is how long a fetched preview is reused for the same URL
+func linkPreviewCacheTTL() time.Duration {
+	return getEnvDuration("LINK_PREVIEW_CACHE_TTL", 24*time.Hour)
+}
+
+// pruneLinkPreviewCache drops cached previews nobody will reuse anymore
+func pruneLinkPreviewCache() {
+	query := `DELETE FROM link_previews WHERE fetched_at < $1`
+	if _, err := db.GetDB().Exec(query, time.Now().Add(-linkPreviewCacheTTL())); err != nil {
+		log.Printf("Error pruning link preview cache: %v", err)
+	}
+}
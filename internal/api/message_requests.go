@@ -0,0 +1,315 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Message request statuses
+const (
+	RequestPending  = "pending"
+	RequestAccepted = "accepted"
+	RequestDeclined = "declined"
+)
+
+// maxRequestMessages caps how many held messages are returned for a single request
+const maxRequestMessages = 50
+
+// heldMessageFilter hides DMs sent to the user ($1) by senders whose message request
+// hasn't been accepted. It expects messages aliased as m.
+const heldMessageFilter = `NOT EXISTS (
+		    SELECT 1 FROM message_requests r
+		    WHERE m.receiver_id = $1 AND r.receiver_id = $1 AND r.sender_id = m.sender_id
+		      AND r.status <> 'accepted'
+		)`
+
+// MessageRequest is a pending first-contact DM thread in the receiver's requests folder
+type MessageRequest struct {
+	ID            int         `json:"id"`
+	Sender        UserSummary `json:"sender"`
+	Preview       string      `json:"preview"`
+	MessageCount  int         `json:"message_count"`
+	LastMessageAt time.Time   `json:"last_message_at"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+// holdAsMessageRequest runs inside the send transaction of a DM. Messaging the sender of
+// a request accepts it; a first DM to someone the sender shares no group (channels don't
+// count), no earlier conversation and no contact entry with opens a new pending request.
+// A first DM that isn't held is recorded as an accepted request, so the conversation
+// stays established after its messages disappear or are purged.
+func holdAsMessageRequest(tx *sql.Tx, senderID, receiverID int) error {
+	// Messaging the sender of a request accepts it, even one declined earlier
+	query := `UPDATE message_requests SET status = 'accepted', responded_at = NOW()
+		WHERE sender_id = $1 AND receiver_id = $2 AND status <> 'accepted'`
+	if _, err := tx.Exec(query, receiverID, senderID); err != nil {
+		return err
+	}
+
+	// An existing request (in any state) already decides visibility
+	var hasRequest bool
+	query = `SELECT EXISTS(SELECT 1 FROM message_requests WHERE sender_id = $1 AND receiver_id = $2)`
+	if err := tx.QueryRow(query, senderID, receiverID).Scan(&hasRequest); err != nil {
+		return err
+	}
+	if hasRequest {
+		return nil
+	}
+
+	// The receiver started the conversation, or an accepted request from them exists
+	var priorConversation, sharedGroup, isContact bool
+	query = `
+		SELECT
+			EXISTS(SELECT 1 FROM message_requests WHERE sender_id = $2 AND receiver_id = $1 AND status = 'accepted'),
+			EXISTS(SELECT 1 FROM group_members a
+			    INNER JOIN group_members b ON b.group_id = a.group_id
+			    INNER JOIN groups g ON g.id = a.group_id
+			    WHERE a.member_id = $1 AND b.member_id = $2 AND g.group_type = 'group'),
+			EXISTS(SELECT 1 FROM user_contacts WHERE owner_id = $2 AND contact_id = $1)`
+	err := tx.QueryRow(query, senderID, receiverID).Scan(&priorConversation, &sharedGroup, &isContact)
+	if err != nil {
+		return err
+	}
+	status := RequestPending
+	if priorConversation || sharedGroup || isContact {
+		status = RequestAccepted
+	}
+
+	query = `INSERT INTO message_requests (sender_id, receiver_id, status, responded_at)
+		VALUES ($1, $2, $3, CASE WHEN $3 = 'accepted' THEN NOW() END)
+		ON CONFLICT DO NOTHING`
+	_, err = tx.Exec(query, senderID, receiverID, status)
+	return err
+}
+
+// pendingRequestParam loads the pending request named by the :id URL parameter.
+// Only the receiver can see or act on a request.
+func pendingRequestParam(c *gin.Context, userID int) (requestID, senderID int, ok bool) {
+	requestID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return 0, 0, false
+	}
+
+	query := `SELECT sender_id FROM message_requests WHERE id = $1 AND receiver_id = $2 AND status = 'pending'`
+	err = db.GetDB().QueryRow(query, requestID, userID).Scan(&senderID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message request not found"})
+			return 0, 0, false
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load message request"})
+		return 0, 0, false
+	}
+	return requestID, senderID, true
+}
+
+// respondToRequest moves a pending request to its final status
+func respondToRequest(requestID int, status string) error {
+	query := `UPDATE message_requests SET status = $1, responded_at = NOW() WHERE id = $2 AND status = 'pending'`
+	_, err := db.GetDB().Exec(query, status, requestID)
+	return err
+}
+
+// GetMessageRequestsHandler lists the pending message requests received by the current user
+func GetMessageRequestsHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	query := `
+		SELECT r.id, r.created_at, u.id, u.username, u.display_name, u.avatar_url,
+		       last.content, last.created_at, counts.total
+		FROM message_requests r
+		INNER JOIN users u ON u.id = r.sender_id
+		CROSS JOIN LATERAL (
+		    SELECT m.content, m.created_at FROM messages m
+		    WHERE m.sender_id = r.sender_id AND m.receiver_id = r.receiver_id AND m.group_id IS NULL
+		      AND ` + unexpiredMessageFilter + `
+		    ORDER BY m.created_at DESC
+		    LIMIT 1
+		) last
+		CROSS JOIN LATERAL (
+		    SELECT COUNT(*) AS total FROM messages m
+		    WHERE m.sender_id = r.sender_id AND m.receiver_id = r.receiver_id AND m.group_id IS NULL
+		      AND ` + unexpiredMessageFilter + `
+		) counts
+		WHERE r.receiver_id = $1 AND r.status = 'pending'
+		  AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = r.sender_id)
+		ORDER BY last.created_at DESC`
+
+	rows, err := db.GetDB().Query(query, int(userIDInt))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve message requests"})
+		return
+	}
+	defer rows.Close()
+
+	requests := []MessageRequest{}
+	for rows.Next() {
+		var req MessageRequest
+		err := rows.Scan(&req.ID, &req.CreatedAt, &req.Sender.ID, &req.Sender.Username, &req.Sender.DisplayName,
+			&req.Sender.AvatarURL, &req.Preview, &req.LastMessageAt, &req.MessageCount)
+		if err != nil {
+			log.Printf("Error scanning message request: %v", err)
+			continue
+		}
+		requests = append(requests, req)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+// GetMessageRequestMessagesHandler returns the held messages of a pending request so the
+// receiver can read them before deciding
+func GetMessageRequestMessagesHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	_, senderID, ok := pendingRequestParam(c, int(userIDInt))
+	if !ok {
+		return
+	}
+
+	query := `
+		SELECT ` + messageSelectColumns("$2") + `
+		FROM messages m
+		INNER JOIN users u ON u.id = m.sender_id
+		WHERE m.group_id IS NULL AND m.sender_id = $1 AND m.receiver_id = $2 AND ` + unexpiredMessageFilter + `
+		ORDER BY m.created_at ASC
+		LIMIT $3`
+
+	rows, err := db.GetDB().Query(query, senderID, int(userIDInt), maxRequestMessages)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+	defer rows.Close()
+
+	messages := scanMessages(rows)
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// AcceptMessageRequestHandler moves a request's messages into the receiver's conversations
+func AcceptMessageRequestHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	requestID, _, ok := pendingRequestParam(c, int(userIDInt))
+	if !ok {
+		return
+	}
+
+	if err := respondToRequest(requestID, RequestAccepted); err != nil {
+		log.Printf("Error accepting message request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept message request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message request accepted"})
+}
+
+// DeclineMessageRequestHandler dismisses a request. The sender is not told; their
+// messages, including any sent later, stay hidden from the receiver.
+func DeclineMessageRequestHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	requestID, _, ok := pendingRequestParam(c, int(userIDInt))
+	if !ok {
+		return
+	}
+
+	if err := respondToRequest(requestID, RequestDeclined); err != nil {
+		log.Printf("Error declining message request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline message request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message request declined"})
+}
+
+// BlockMessageRequestHandler declines a request and blocks its sender
+func BlockMessageRequestHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	requestID, senderID, ok := pendingRequestParam(c, int(userIDInt))
+	if !ok {
+		return
+	}
+
+	if err := blockUser(int(userIDInt), senderID); err != nil {
+		log.Printf("Error blocking user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+
+	if err := respondToRequest(requestID, RequestDeclined); err != nil {
+		log.Printf("Error declining message request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline message request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message request declined and user blocked"})
+}
@@ -1,8 +1,13 @@
 package api
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"messaging-system/pkg/db"
@@ -10,22 +15,92 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Page sizes for group message history
+const (
+	defaultGroupMessagesLimit = 10
+	maxGroupMessagesLimit     = 100
+)
+
 // SendMessageRequest defines the structure for sending messages
 type SendMessageRequest struct {
-	ReceiverID *int   `json:"receiver_id,omitempty"` // For DM
-	GroupID    *int   `json:"group_id,omitempty"`    // For group message
-	Content    string `json:"content" binding:"required"`
+	ReceiverID      *int            `json:"receiver_id,omitempty"`       // For DM
+	GroupID         *int            `json:"group_id,omitempty"`          // For group message
+	Content         string          `json:"content"`                     // Required for text and markdown
+	MessageType     string          `json:"message_type,omitempty"`      // Defaults to text
+	Payload         json.RawMessage `json:"payload,omitempty"`           // For location, contact and poll messages
+	SendAt          *time.Time      `json:"send_at,omitempty"`           // Deliver later instead of now
+	ClientMessageID string          `json:"client_message_id,omitempty"` // Makes retries safe; the Idempotency-Key header works too
 }
 
 // Message represents a message in the system
 type Message struct {
-	ID         int       `json:"id"`
-	SenderID   int       `json:"sender_id"`
-	ReceiverID *int      `json:"receiver_id,omitempty"`
-	GroupID    *int      `json:"group_id,omitempty"`
-	Content    string    `json:"content"`
-	CreatedAt  time.Time `json:"created_at"`
-	IsGroup    bool      `json:"is_group"` // Computed field based on GroupID != nil
+	ID              int             `json:"id"`
+	SenderID        int             `json:"sender_id"`
+	ReceiverID      *int            `json:"receiver_id,omitempty"`
+	GroupID         *int            `json:"group_id,omitempty"`
+	Content         string          `json:"content"`
+	MessageType     string          `json:"message_type"`                // text, markdown, system, location, contact or poll
+	Payload         json.RawMessage `json:"payload,omitempty"`           // Structured content of location, contact and poll messages
+	RenderHints     json.RawMessage `json:"render_hints,omitempty"`      // Format plus mention and link spans
+	LinkPreview     json.RawMessage `json:"link_preview,omitempty"`      // Attached shortly after sending when the message has a link
+	GroupEventID    *int            `json:"group_event_id,omitempty"`    // The group event a system message describes
+	ClientMessageID *string         `json:"client_message_id,omitempty"` // Lets the sending client match its pending copy
+	Forwarded       bool            `json:"forwarded"`
+	ForwardedFrom   *int            `json:"forwarded_from_sender_id,omitempty"`
+	ForwardCount    int             `json:"forward_count"`
+	CreatedAt       time.Time       `json:"created_at"`
+	ExpiresAt       *time.Time      `json:"expires_at,omitempty"` // Set when the conversation has a disappearing message timer
+	Pinned          bool            `json:"pinned"`
+	IsGroup         bool            `json:"is_group"`         // Computed field based on GroupID != nil
+	Sender          *UserSummary    `json:"sender,omitempty"` // Sender display info, saves clients a lookup per message
+}
+
+// messageSelectColumns is the column list shared by message listing queries, for the
+// caller passed as the given parameter. It expects messages aliased as m and the sender
+// joined as u. client_message_id is only returned to the sender.
+func messageSelectColumns(callerParam string) string {
+	return `m.id, m.sender_id, m.receiver_id, m.group_id, m.content, m.message_type,
+		m.payload, m.render_hints, m.link_preview, m.group_event_id,
+		CASE WHEN m.sender_id = ` + callerParam + ` THEN m.client_message_id END, m.created_at, m.expires_at,
+		m.is_forwarded, m.forwarded_from_sender_id,
+		COALESCE((SELECT f.forward_count FROM messages f WHERE f.id = m.forwarded_from_id), m.forward_count),
+		u.username, u.display_name, u.avatar_url,
+		EXISTS(SELECT 1 FROM pinned_messages pm WHERE pm.message_id = m.id)`
+}
+
+// scanMessage reads one row selected with messageSelectColumns, followed by any extra columns
+func scanMessage(rows *sql.Rows, extra ...interface{}) (Message, error) {
+	var msg Message
+	var sender UserSummary
+	dest := []interface{}{&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.GroupID, &msg.Content, &msg.MessageType,
+		(*[]byte)(&msg.Payload), (*[]byte)(&msg.RenderHints), (*[]byte)(&msg.LinkPreview), &msg.GroupEventID, &msg.ClientMessageID, &msg.CreatedAt,
+		&msg.ExpiresAt, &msg.Forwarded, &msg.ForwardedFrom, &msg.ForwardCount, &sender.Username, &sender.DisplayName, &sender.AvatarURL, &msg.Pinned}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return msg, err
+	}
+	sender.ID = msg.SenderID
+	msg.Sender = &sender
+	// System messages and messages from before rendering hints have none stored
+	if msg.RenderHints == nil {
+		msg.RenderHints = renderHints(msg.MessageType, msg.Content, nil)
+	}
+	// Compute is_group field based on whether group_id is set
+	msg.IsGroup = msg.GroupID != nil
+	return msg, nil
+}
+
+// scanMessages reads rows selected with messageSelectColumns
+func scanMessages(rows *sql.Rows) []Message {
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			log.Printf("Error scanning message: %v", err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages
 }
 
 // SendMessageHandler handles sending messages (both DM and group)
@@ -50,37 +125,109 @@ func SendMessageHandler(c *gin.Context) {
 		return
 	}
 
+	// Optionally require a verified mobile number before messaging
+	if err := requireVerifiedPhone(int(senderIDInt)); err != nil {
+		status := sendErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error checking phone verification: %v", err)
+			c.JSON(status, gin.H{"error": "Failed to send message"})
+			return
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Validate that exactly one of receiver_id or group_id is provided
 	if (req.ReceiverID == nil && req.GroupID == nil) || (req.ReceiverID != nil && req.GroupID != nil) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Either receiver_id or group_id must be provided, but not both"})
 		return
 	}
 
-	// Handle DM (Direct Message)
-	if req.ReceiverID != nil {
-		if err := sendDirectMessage(int(senderIDInt), *req.ReceiverID, req.Content); err != nil {
-			log.Printf("Error sending direct message: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusCreated, gin.H{"message": "Direct message sent successfully"})
+	clientMessageID, ok := clientMessageIDParam(c, req)
+	if !ok {
 		return
 	}
 
-	// Handle Group Message
-	if req.GroupID != nil {
-		if err := sendGroupMessage(int(senderIDInt), *req.GroupID, req.Content); err != nil {
-			log.Printf("Error sending group message: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusCreated, gin.H{"message": "Group message sent successfully"})
+	msg, err := prepareOutgoingMessage(req, clientMessageID)
+	if err != nil {
+		c.JSON(sendErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// Scheduled messages are stored and delivered later by the scheduler
+	if req.SendAt != nil {
+		scheduleMessage(c, int(senderIDInt), req, msg)
+		return
+	}
+
+	// A retry of a message that was already stored gets the original back
+	if clientMessageID != "" && respondWithOriginalMessage(c, int(senderIDInt), req, msg) {
+		return
+	}
+
+	var sent SentMessage
+	successMessage := "Direct message sent successfully"
+	if req.ReceiverID != nil {
+		// Handle DM (Direct Message)
+		sent, err = sendDirectMessage(int(senderIDInt), *req.ReceiverID, msg)
+	} else {
+		// Handle Group Message
+		sent, err = sendGroupMessage(int(senderIDInt), *req.GroupID, msg)
+		successMessage = "Group message sent successfully"
+	}
+
+	// A concurrent retry stored the message first
+	if err == errDuplicateClientMessage && respondWithOriginalMessage(c, int(senderIDInt), req, msg) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error sending message: %v", err)
+		c.JSON(sendErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
+
+	response := gin.H{
+		"message":    successMessage,
+		"message_id": sent.ID,
+		"created_at": sent.CreatedAt,
+	}
+	if clientMessageID != "" {
+		response["client_message_id"] = clientMessageID
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 // sendDirectMessage handles sending a direct message between two users
-func sendDirectMessage(senderID, receiverID int, content string) error {
+func sendDirectMessage(senderID, receiverID int, msg outgoingMessage) (SentMessage, error) {
+	if err := checkDirectMessage(senderID, receiverID); err != nil {
+		return SentMessage{}, err
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		return SentMessage{}, err
+	}
+	defer tx.Rollback()
+
+	sent, err := insertDirectMessageTx(tx, senderID, receiverID, msg)
+	if err != nil {
+		return sent, err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return sent, err
+	}
+	if wantsLinkPreview(msg) {
+		wakeLinkPreviewer()
+	}
+	wakePushDispatcher()
+	return sent, nil
+}
+
+// checkDirectMessage checks that senderID may send a direct message to receiverID
+func checkDirectMessage(senderID, receiverID int) error {
 	// Validate that receiver exists
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`
@@ -97,14 +244,103 @@ func sendDirectMessage(senderID, receiverID int, content string) error {
 		return &ValidationError{"Cannot send message to yourself"}
 	}
 
-	// Insert the message
-	query = `INSERT INTO messages (sender_id, receiver_id, content) VALUES ($1, $2, $3)`
-	_, err = db.GetDB().Exec(query, senderID, receiverID, content)
-	return err
+	// Enforce blocks and the receiver's DM privacy setting
+	return checkUserInteraction(senderID, receiverID, "send them direct messages")
+}
+
+// insertDirectMessageTx stores a direct message inside tx. errDuplicateClientMessage
+// means the sender already has a message with the same client_message_id.
+func insertDirectMessageTx(tx *sql.Tx, senderID, receiverID int, msg outgoingMessage) (SentMessage, error) {
+	// First contact from a stranger is held in the receiver's message requests
+	if err := holdAsMessageRequest(tx, senderID, receiverID); err != nil {
+		return SentMessage{}, err
+	}
+
+	// Insert the message (mentions are only resolved in groups)
+	hints := renderHints(msg.messageType, msg.content, nil)
+	return insertMessageTx(tx, "receiver_id", directMessageExpiry, senderID, receiverID, msg, hints)
+}
+
+// insertMessageTx stores a message in the receiver_id or group_id conversation given by
+// targetColumn, with the matching expiry expression
+func insertMessageTx(tx *sql.Tx, targetColumn, expiry string, senderID, targetID int, msg outgoingMessage, hints []byte) (SentMessage, error) {
+	var origin forwardOrigin
+	if msg.forwardedFrom != nil {
+		origin = *msg.forwardedFrom
+	}
+
+	query := `INSERT INTO messages (sender_id, ` + targetColumn + `, content, message_type, payload, render_hints,
+			link_preview, link_preview_pending, is_forwarded, forwarded_from_id, forwarded_from_sender_id,
+			expires_at, client_message_id, push_pending)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, ` + expiry + `, $12, $13)
+		ON CONFLICT (sender_id, client_message_id) WHERE client_message_id IS NOT NULL DO NOTHING
+		RETURNING id, created_at`
+	return scanSentMessage(tx.QueryRow(query, senderID, targetID, msg.content, msg.messageType,
+		nullableJSON(msg.payload), hints, nullableJSON(msg.linkPreview), wantsLinkPreview(msg),
+		msg.forwardedFrom != nil, nullableID(origin.messageID), nullableID(origin.senderID),
+		nullableClientMessageID(msg.clientMessageID), pushNotificationsEnabled()))
 }
 
 // sendGroupMessage handles sending a message to a group
-func sendGroupMessage(senderID, groupID int, content string) error {
+func sendGroupMessage(senderID, groupID int, msg outgoingMessage) (SentMessage, error) {
+	if err := checkGroupMessage(senderID, groupID); err != nil {
+		return SentMessage{}, err
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		return SentMessage{}, err
+	}
+	defer tx.Rollback()
+
+	sent, err := insertGroupMessageTx(tx, senderID, groupID, msg)
+	if err != nil {
+		return sent, err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return sent, err
+	}
+	if wantsLinkPreview(msg) {
+		wakeLinkPreviewer()
+	}
+	wakePushDispatcher()
+	return sent, nil
+}
+
+// insertGroupMessageTx stores a group message inside tx along with the members it mentions.
+// errDuplicateClientMessage means the sender already has a message with the same client_message_id.
+func insertGroupMessageTx(tx *sql.Tx, senderID, groupID int, msg outgoingMessage) (SentMessage, error) {
+	members, err := resolveMentionsTx(tx, groupID, msg.content)
+	if err != nil {
+		return SentMessage{}, err
+	}
+
+	// Insert the group message
+	hints := renderHints(msg.messageType, msg.content, members)
+	sent, err := insertMessageTx(tx, "group_id", groupMessageExpiry, senderID, groupID, msg, hints)
+	if err != nil {
+		return sent, err
+	}
+
+	// Forwarded copies don't notify the people the original mentioned
+	if msg.forwardedFrom == nil {
+		if err := recordMentionsTx(tx, sent.ID, senderID, members); err != nil {
+			return sent, err
+		}
+	}
+
+	// Poll messages come with the poll members vote in
+	if msg.messageType == MessageTypePoll {
+		return sent, createPollTx(tx, sent.ID, groupID, senderID, msg.payload)
+	}
+	return sent, nil
+}
+
+// checkGroupMessage checks that senderID may post in the group
+func checkGroupMessage(senderID, groupID int) error {
 	// Check if group exists
 	var groupExists bool
 	query := `SELECT EXISTS(SELECT 1 FROM groups WHERE id = $1)`
@@ -116,50 +352,39 @@ func sendGroupMessage(senderID, groupID int, content string) error {
 		return &ValidationError{"Group does not exist"}
 	}
 
-	// Check if sender is a member of the group
-	var isMember bool
-	query = `SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = $1 AND member_id = $2)`
-	err = db.GetDB().QueryRow(query, groupID, senderID).Scan(&isMember)
-	if err != nil {
+	// Check if sender is a member of the group whose role allows posting
+	if _, err := authorizeGroupAction(groupID, senderID, PermPost); err != nil {
 		return err
 	}
-	if !isMember {
-		return &ValidationError{"You are not a member of this group"}
-	}
 
 	// Check group constraints
-	if err := validateGroupConstraints(groupID); err != nil {
-		return err
-	}
-
-	// Insert the group message
-	query = `INSERT INTO messages (sender_id, group_id, content) VALUES ($1, $2, $3)`
-	_, err = db.GetDB().Exec(query, senderID, groupID, content)
-	return err
+	return validateGroupConstraints(groupID)
 }
 
-// validateGroupConstraints checks if group meets the requirements
+// validateGroupConstraints checks if group meets the requirements for its type
 func validateGroupConstraints(groupID int) error {
-	// Check member count (max 25 members)
+	// Use the stored member count so large channels aren't counted on every message
+	var groupType string
 	var memberCount int
-	query := `SELECT COUNT(*) FROM group_members WHERE group_id = $1`
-	err := db.GetDB().QueryRow(query, groupID).Scan(&memberCount)
+	query := `SELECT group_type, member_count FROM groups WHERE id = $1`
+	err := db.GetDB().QueryRow(query, groupID).Scan(&groupType, &memberCount)
 	if err != nil {
 		return err
 	}
-	if memberCount > 25 {
-		return &ValidationError{"Group has exceeded maximum member limit of 25"}
+	maxMembers, maxAdmins := groupLimits(groupType)
+	if memberCount > maxMembers {
+		return &ValidationError{fmt.Sprintf("Group has exceeded maximum member limit of %d", maxMembers)}
 	}
 
-	// Check admin count (max 2 admins)
+	// Check admin count
 	var adminCount int
 	query = `SELECT COUNT(*) FROM group_members WHERE group_id = $1 AND is_admin = true`
 	err = db.GetDB().QueryRow(query, groupID).Scan(&adminCount)
 	if err != nil {
 		return err
 	}
-	if adminCount > 2 {
-		return &ValidationError{"Group has exceeded maximum admin limit of 2"}
+	if adminCount > maxAdmins {
+		return &ValidationError{fmt.Sprintf("Group has exceeded maximum admin limit of %d", maxAdmins)}
 	}
 
 	return nil
@@ -174,6 +399,53 @@ func (e *ValidationError) Error() string {
 	return e.Message
 }
 
+// ForbiddenError represents an action the user is not allowed to perform
+type ForbiddenError struct {
+	Message string
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Message
+}
+
+// ConflictError represents a request that conflicts with the current state
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// NotFoundError represents a resource that doesn't exist or that the user can't see
+type NotFoundError struct {
+	Message string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Message
+}
+
+// sendErrorStatus maps errors returned by the send helpers to HTTP status codes
+func sendErrorStatus(err error) int {
+	var validationErr *ValidationError
+	var forbiddenErr *ForbiddenError
+	var conflictErr *ConflictError
+	var notFoundErr *NotFoundError
+	switch {
+	case errors.As(err, &forbiddenErr):
+		return http.StatusForbidden
+	case errors.As(err, &conflictErr):
+		return http.StatusConflict
+	case errors.As(err, &notFoundErr):
+		return http.StatusNotFound
+	case errors.As(err, &validationErr):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // GetMessagesHandler retrieves messages for a user (both DMs and group messages)
 func GetMessagesHandler(c *gin.Context) {
 	// Get user ID from context
@@ -189,15 +461,17 @@ func GetMessagesHandler(c *gin.Context) {
 		return
 	}
 
-	// Query to get all messages where user is sender or receiver
+	// Query to get all messages where user is sender or receiver, minus DMs held as message requests
 	query := `
-		SELECT m.id, m.sender_id, m.receiver_id, m.group_id, m.content, m.created_at
+		SELECT ` + messageSelectColumns("$1") + `
 		FROM messages m
-		WHERE m.sender_id = $1 
+		INNER JOIN users u ON u.id = m.sender_id
+		WHERE (m.sender_id = $1 
 		   OR m.receiver_id = $1 
 		   OR (m.group_id IS NOT NULL AND m.group_id IN (
 		       SELECT group_id FROM group_members WHERE member_id = $1
-		   ))
+		   )))
+		  AND ` + heldMessageFilter + ` AND ` + unexpiredMessageFilter + `
 		ORDER BY m.created_at DESC
 		LIMIT 10`
 
@@ -209,18 +483,7 @@ func GetMessagesHandler(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var messages []Message
-	for rows.Next() {
-		var msg Message
-		err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.GroupID, &msg.Content, &msg.CreatedAt)
-		if err != nil {
-			log.Printf("Error scanning message: %v", err)
-			continue
-		}
-		// Compute is_group field based on whether group_id is set
-		msg.IsGroup = msg.GroupID != nil
-		messages = append(messages, msg)
-	}
+	messages := scanMessages(rows)
 
 	c.JSON(http.StatusOK, gin.H{"messages": messages})
 }
@@ -241,20 +504,21 @@ func GetConversationHandler(c *gin.Context) {
 	}
 
 	// Get other user ID from URL parameter
-	otherUserID := c.Param("user_id")
-	if otherUserID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID parameter is required"})
+	otherUserID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
 	// Query to get conversation between two users
 	query := `
-		SELECT m.id, m.sender_id, m.receiver_id, m.group_id, m.content, m.created_at
+		SELECT ` + messageSelectColumns("$1") + `
 		FROM messages m
+		INNER JOIN users u ON u.id = m.sender_id
 		WHERE m.group_id IS NULL AND (
 		    (m.sender_id = $1 AND m.receiver_id = $2) OR
 		    (m.sender_id = $2 AND m.receiver_id = $1)
-		)
+		) AND ` + heldMessageFilter + ` AND ` + unexpiredMessageFilter + `
 		ORDER BY m.created_at ASC
 		LIMIT 10`
 
@@ -266,23 +530,23 @@ func GetConversationHandler(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var messages []Message
-	for rows.Next() {
-		var msg Message
-		err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.GroupID, &msg.Content, &msg.CreatedAt)
-		if err != nil {
-			log.Printf("Error scanning message: %v", err)
-			continue
-		}
-		// For conversation, is_group is always false
-		msg.IsGroup = false
-		messages = append(messages, msg)
+	messages := scanMessages(rows)
+
+	// The disappearing message timer is part of the conversation metadata
+	ttl, err := conversationTimer(int(userIDInt), otherUserID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversation"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"messages": messages})
+	c.JSON(http.StatusOK, gin.H{
+		"messages":            messages,
+		"message_ttl_seconds": ttl,
+	})
 }
 
-// GetGroupMessagesHandler retrieves messages for a specific group
+// GetGroupMessagesHandler retrieves messages for a specific group or channel, newest first
 func GetGroupMessagesHandler(c *gin.Context) {
 	// Get user ID from context
 	userID, exists := c.Get("user_id")
@@ -297,36 +561,47 @@ func GetGroupMessagesHandler(c *gin.Context) {
 		return
 	}
 
-	// Get group ID from URL parameter
-	groupID := c.Param("group_id")
-	if groupID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Group ID parameter is required"})
+	// Check if user is a member of the group
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermViewGroup)
+	if !ok {
 		return
 	}
 
-	// Check if user is a member of the group
-	var isMember bool
-	query := `SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = $1 AND member_id = $2)`
-	err := db.GetDB().QueryRow(query, groupID, int(userIDInt)).Scan(&isMember)
-	if err != nil {
-		log.Printf("Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify group membership"})
-		return
+	limit := defaultGroupMessagesLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxGroupMessagesLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxGroupMessagesLimit)})
+			return
+		}
+		limit = parsed
 	}
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
-		return
+
+	// Keyset pagination: ?before=<message id> returns the page older than that message.
+	// Together with idx_messages_group_created_id this stays an index range scan no matter
+	// how large the group or channel gets.
+	args := []interface{}{groupID, limit, int(userIDInt)}
+	cursor := ""
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		before, err := strconv.Atoi(beforeStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before must be a message ID"})
+			return
+		}
+		args = append(args, before)
+		cursor = `AND (m.created_at, m.id) < (SELECT created_at, id FROM messages WHERE id = $4 AND group_id = $1)`
 	}
 
 	// Query to get group messages
-	query = `
-		SELECT m.id, m.sender_id, m.receiver_id, m.group_id, m.content, m.created_at
+	query := `
+		SELECT ` + messageSelectColumns("$3") + `
 		FROM messages m
-		WHERE m.group_id = $1
-		ORDER BY m.created_at DESC
-		LIMIT 10`
+		INNER JOIN users u ON u.id = m.sender_id
+		WHERE m.group_id = $1 AND ` + unexpiredMessageFilter + ` ` + cursor + `
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT $2`
 
-	rows, err := db.GetDB().Query(query, groupID)
+	rows, err := db.GetDB().Query(query, args...)
 	if err != nil {
 		log.Printf("Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve group messages"})
@@ -334,18 +609,20 @@ func GetGroupMessagesHandler(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var messages []Message
-	for rows.Next() {
-		var msg Message
-		err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.GroupID, &msg.Content, &msg.CreatedAt)
-		if err != nil {
-			log.Printf("Error scanning message: %v", err)
-			continue
-		}
-		// For group messages, is_group is always true
-		msg.IsGroup = true
-		messages = append(messages, msg)
+	messages := scanMessages(rows)
+
+	var ttl *int
+	query = `SELECT message_ttl_seconds FROM groups WHERE id = $1`
+	if err := db.GetDB().QueryRow(query, groupID).Scan(&ttl); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve group messages"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"messages": messages})
+	response := gin.H{"messages": messages, "message_ttl_seconds": ttl}
+	if len(messages) == limit {
+		response["next_before"] = messages[len(messages)-1].ID
+	}
+
+	c.JSON(http.StatusOK, response)
 }
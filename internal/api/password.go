@@ -0,0 +1,316 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"messaging-system/internal/auth"
+	"messaging-system/internal/notify"
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ChangePasswordRequest defines the structure for changing the current user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ForgotPasswordRequest defines the structure for requesting a password reset
+type ForgotPasswordRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// ResetPasswordRequest defines the structure for completing a password reset
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// hashResetToken returns the value stored in the database for a reset token
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateResetToken creates a random URL-safe reset token
+func generateResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// updatePasswordTx stores a new password hash, invalidates outstanding reset tokens
+// and records the change time used to revoke older sessions
+func updatePasswordTx(tx *sql.Tx, userID int, hashedPassword string, changedAt time.Time) error {
+	query := `UPDATE users SET password = $1, password_changed_at = $2 WHERE id = $3`
+	if _, err := tx.Exec(query, hashedPassword, changedAt, userID); err != nil {
+		return err
+	}
+
+	query = `UPDATE password_reset_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL`
+	_, err := tx.Exec(query, changedAt, userID)
+	return err
+}
+
+// revokeUserSessions invalidates every token issued to the user before changedAt
+func revokeUserSessions(userID int, changedAt time.Time) {
+	refreshTokenDuration := getEnvDuration("REFRESH_TOKEN_DURATION", 7*24*time.Hour)
+	auth.GetTokenBlacklist().RevokeUserTokens(userID, changedAt, changedAt.Add(refreshTokenDuration))
+}
+
+// ChangePasswordHandler changes the authenticated user's password and revokes all other sessions
+func ChangePasswordHandler(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Fetch the current password hash
+	var username, currentHash string
+	query := `SELECT username, password FROM users WHERE id = $1`
+	err := db.GetDB().QueryRow(query, int(userIDInt)).Scan(&username, &currentHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Verify the current password
+	if err := bcrypt.CompareHashAndPassword([]byte(currentHash), []byte(req.CurrentPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	// Enforce the password policy
+	if err := auth.GetPasswordPolicy().Validate(req.NewPassword, username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	defer tx.Rollback()
+
+	changedAt := time.Now()
+	if err := updatePasswordTx(tx, int(userIDInt), string(hashedPassword), changedAt); err != nil {
+		log.Printf("Error updating password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Revoke every existing session, then issue fresh tokens for this one
+	revokeUserSessions(int(userIDInt), changedAt)
+
+	accessTokenString, refreshTokenString, err := generateTokenPair(int(userIDInt), username)
+	if err != nil {
+		log.Printf("Error generating tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed, but failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Password changed successfully",
+		"access_token":  accessTokenString,
+		"refresh_token": refreshTokenString,
+	})
+}
+
+// ForgotPasswordHandler issues a reset token and delivers it through the configured notifier.
+// The response is the same whether or not the user exists, to avoid leaking usernames.
+func ForgotPasswordHandler(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"message": "If the account exists, password reset instructions have been sent"}
+
+	// Fetch the user
+	var recipient notify.Recipient
+	var email sql.NullString
+	query := `SELECT id, username, email FROM users WHERE username = $1`
+	err := db.GetDB().QueryRow(query, req.Username).Scan(&recipient.UserID, &recipient.Username, &email)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Database error: %v", err)
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	recipient.Email = email.String
+
+	// Throttle: don't issue a new token if one was created in the last minute
+	var recentlyIssued bool
+	query = `SELECT EXISTS(
+		SELECT 1 FROM password_reset_tokens
+		WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 minute'
+	)`
+	err = db.GetDB().QueryRow(query, recipient.UserID).Scan(&recentlyIssued)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if recentlyIssued {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, err := generateResetToken()
+	if err != nil {
+		log.Printf("Error generating reset token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+		return
+	}
+
+	tokenDuration := getEnvDuration("PASSWORD_RESET_TOKEN_DURATION", 30*time.Minute)
+	expiresAt := time.Now().Add(tokenDuration)
+
+	query = `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	_, err = db.GetDB().Exec(query, recipient.UserID, hashResetToken(token), expiresAt)
+	if err != nil {
+		log.Printf("Error storing reset token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+		return
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nUse this token to reset your password: %s\n", recipient.Username, token)
+	if resetURL := os.Getenv("PASSWORD_RESET_URL"); resetURL != "" {
+		body += fmt.Sprintf("\nOr open: %s?token=%s\n", resetURL, token)
+	}
+	body += fmt.Sprintf("\nThe token expires at %s. If you did not request a reset, ignore this message.\n",
+		expiresAt.Format(time.RFC1123))
+
+	// Deliver in the background so response timing doesn't reveal whether the user exists
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := notify.GetNotifier().Notify(ctx, notify.Message{
+			To:      recipient,
+			Subject: "Password reset",
+			Body:    body,
+		})
+		if err != nil {
+			log.Printf("Error delivering password reset for user %d: %v", recipient.UserID, err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetPasswordHandler sets a new password using a reset token and revokes all sessions
+func ResetPasswordHandler(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Enforce the password policy before consuming the token
+	if err := auth.GetPasswordPolicy().Validate(req.NewPassword, ""); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Consume the token; the WHERE clause makes it single use even under concurrent requests
+	changedAt := time.Now()
+	var userID int
+	query := `UPDATE password_reset_tokens SET used_at = $1
+		WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id`
+	err = tx.QueryRow(query, changedAt, hashResetToken(req.Token)).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := updatePasswordTx(tx, userID, string(hashedPassword), changedAt); err != nil {
+		log.Printf("Error updating password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	revokeUserSessions(userID, changedAt)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully, please log in again"})
+}
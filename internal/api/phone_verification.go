@@ -0,0 +1,276 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"messaging-system/internal/sms"
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfirmPhoneRequest defines the structure for confirming a phone verification code
+type ConfirmPhoneRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// generatePhoneCode creates a uniformly random 6-digit code
+func generatePhoneCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashPhoneCode binds a code to the user and number it was sent to
+func hashPhoneCode(userID int, mobileNo, code string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s", userID, mobileNo, code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// requireVerifiedPhone blocks messaging for users without a verified number
+// when REQUIRE_VERIFIED_PHONE is enabled
+func requireVerifiedPhone(userID int) error {
+	if !getEnvBool("REQUIRE_VERIFIED_PHONE", false) {
+		return nil
+	}
+
+	var verified bool
+	query := `SELECT mobile_verified FROM users WHERE id = $1`
+	if err := db.GetDB().QueryRow(query, userID).Scan(&verified); err != nil {
+		return err
+	}
+	if !verified {
+		return &ForbiddenError{"Verify your mobile number before sending messages"}
+	}
+	return nil
+}
+
+// RequestPhoneVerificationHandler sends a one-time code to the user's mobile number
+func RequestPhoneVerificationHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Fetch the number to verify
+	var mobileNo sql.NullString
+	var verified bool
+	query := `SELECT mobile_no, mobile_verified FROM users WHERE id = $1`
+	err := db.GetDB().QueryRow(query, int(userIDInt)).Scan(&mobileNo, &verified)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start verification"})
+		return
+	}
+	if !mobileNo.Valid || mobileNo.String == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No mobile number on this account"})
+		return
+	}
+	if verified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Mobile number is already verified"})
+		return
+	}
+
+	// Enforce a cool-down between codes
+	resendInterval := getEnvDuration("PHONE_CODE_RESEND_INTERVAL", 60*time.Second)
+	var recentlySent bool
+	query = `SELECT EXISTS(
+		SELECT 1 FROM phone_verifications WHERE user_id = $1 AND created_at > $2
+	)`
+	err = db.GetDB().QueryRow(query, int(userIDInt), time.Now().Add(-resendInterval)).Scan(&recentlySent)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start verification"})
+		return
+	}
+	if recentlySent {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting another code"})
+		return
+	}
+
+	code, err := generatePhoneCode()
+	if err != nil {
+		log.Printf("Error generating verification code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start verification"})
+		return
+	}
+
+	codeTTL := getEnvDuration("PHONE_CODE_TTL", 10*time.Minute)
+	expiresAt := time.Now().Add(codeTTL)
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start verification"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Only the newest code is valid
+	query = `UPDATE phone_verifications SET consumed_at = NOW() WHERE user_id = $1 AND consumed_at IS NULL`
+	_, err = tx.Exec(query, int(userIDInt))
+	if err != nil {
+		log.Printf("Error invalidating previous codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start verification"})
+		return
+	}
+
+	query = `INSERT INTO phone_verifications (user_id, mobile_no, code_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err = tx.Exec(query, int(userIDInt), mobileNo.String, hashPhoneCode(int(userIDInt), mobileNo.String, code), expiresAt, time.Now())
+	if err != nil {
+		log.Printf("Error storing verification code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start verification"})
+		return
+	}
+
+	// Send the code before committing so a failed send leaves no usable code behind
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+	body := fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, int(codeTTL.Minutes()))
+	if err := sms.GetProvider().Send(ctx, mobileNo.String, body); err != nil {
+		log.Printf("Error sending verification SMS to user %d: %v", int(userIDInt), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send verification code"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start verification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Verification code sent",
+		"expires_at": expiresAt,
+	})
+}
+
+// ConfirmPhoneVerificationHandler checks a one-time code and marks the number as verified
+func ConfirmPhoneVerificationHandler(c *gin.Context) {
+	var req ConfirmPhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	maxAttempts := getEnvInt("PHONE_CODE_MAX_ATTEMPTS", 5)
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the active code so concurrent guesses are counted correctly
+	var verification struct {
+		ID       int
+		MobileNo string
+		CodeHash string
+		Attempts int
+	}
+	query := `SELECT id, mobile_no, code_hash, attempts FROM phone_verifications
+		WHERE user_id = $1 AND consumed_at IS NULL AND expires_at > $2 AND attempts < $3
+		ORDER BY created_at DESC
+		LIMIT 1
+		FOR UPDATE`
+	err = tx.QueryRow(query, int(userIDInt), time.Now(), maxAttempts).Scan(
+		&verification.ID, &verification.MobileNo, &verification.CodeHash, &verification.Attempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No active verification code, please request a new one"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	expected := hashPhoneCode(int(userIDInt), verification.MobileNo, req.Code)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(verification.CodeHash)) != 1 {
+		query = `UPDATE phone_verifications SET attempts = attempts + 1 WHERE id = $1`
+		if _, err := tx.Exec(query, verification.ID); err != nil {
+			log.Printf("Error recording failed attempt: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			log.Printf("Error committing transaction: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+			return
+		}
+
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":              "Invalid verification code",
+			"attempts_remaining": maxAttempts - verification.Attempts - 1,
+		})
+		return
+	}
+
+	query = `UPDATE phone_verifications SET consumed_at = NOW() WHERE id = $1`
+	if _, err := tx.Exec(query, verification.ID); err != nil {
+		log.Printf("Error consuming verification code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	// Only mark verified if the number hasn't changed since the code was sent
+	query = `UPDATE users SET mobile_verified = true WHERE id = $1 AND mobile_no = $2`
+	result, err := tx.Exec(query, int(userIDInt), verification.MobileNo)
+	if err != nil {
+		log.Printf("Error marking number verified: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows != 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Mobile number has changed, please request a new code"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mobile number verified successfully"})
+}
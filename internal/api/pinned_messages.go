@@ -0,0 +1,345 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PinnedMessage is a pinned message with who pinned it and when
+type PinnedMessage struct {
+	Message  Message   `json:"message"`
+	PinnedBy int       `json:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+// pinConversation identifies the conversation a pin belongs to: a group,
+// or the DM between two users (lowID < highID)
+type pinConversation struct {
+	groupID       int
+	lowID, highID int
+}
+
+// maxPinnedMessages is the number of pins allowed per conversation
+func maxPinnedMessages() int {
+	return getEnvInt("MAX_PINNED_MESSAGES", 10)
+}
+
+// dmPair orders two user IDs the way pinned_messages stores them
+func dmPair(a, b int) (int, int) {
+	if a < b {
+		return a, b
+	}
+	return b, a
+}
+
+// pinnableMessage loads a message the user can see and checks they may pin it:
+// group messages need the pin permission, DMs can be pinned by either participant.
+func pinnableMessage(messageID, userID int) (pinConversation, error) {
+	var conv pinConversation
+	var senderID int
+	var receiverID, groupID sql.NullInt64
+	query := `SELECT m.sender_id, m.receiver_id, m.group_id FROM messages m
+		WHERE m.id = $2 AND ` + heldMessageFilter + ` AND ` + unexpiredMessageFilter
+	err := db.GetDB().QueryRow(query, userID, messageID).Scan(&senderID, &receiverID, &groupID)
+	if err == sql.ErrNoRows {
+		return conv, &NotFoundError{"Message not found"}
+	}
+	if err != nil {
+		return conv, err
+	}
+
+	if groupID.Valid {
+		conv.groupID = int(groupID.Int64)
+		_, err := authorizeGroupAction(conv.groupID, userID, PermPin)
+		return conv, err
+	}
+
+	if userID != senderID && int64(userID) != receiverID.Int64 {
+		return conv, &NotFoundError{"Message not found"}
+	}
+	conv.lowID, conv.highID = dmPair(senderID, int(receiverID.Int64))
+	return conv, nil
+}
+
+// lockPinConversationTx serializes pin changes in a conversation so the pin limit holds
+func lockPinConversationTx(tx *sql.Tx, conv pinConversation) error {
+	if conv.groupID != 0 {
+		_, _, err := lockGroupTx(tx, conv.groupID)
+		return err
+	}
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, $2)`, conv.lowID, conv.highID)
+	return err
+}
+
+// messageIDParam parses the :message_id URL parameter
+func messageIDParam(c *gin.Context) (int, bool) {
+	messageID, err := strconv.Atoi(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return 0, false
+	}
+	return messageID, true
+}
+
+// PinMessageHandler pins a message in its conversation
+func PinMessageHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	messageID, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	conv, err := pinnableMessage(messageID, int(userIDInt))
+	if err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin message"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin message"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockPinConversationTx(tx, conv); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin message"})
+		return
+	}
+
+	var alreadyPinned bool
+	var pinCount int
+	query := `SELECT
+			EXISTS(SELECT 1 FROM pinned_messages WHERE message_id = $1),
+			(SELECT COUNT(*) FROM pinned_messages
+			 WHERE group_id = $2 OR (user_low_id = $3 AND user_high_id = $4))`
+	err = tx.QueryRow(query, messageID, conv.groupID, conv.lowID, conv.highID).Scan(&alreadyPinned, &pinCount)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin message"})
+		return
+	}
+	if alreadyPinned {
+		c.JSON(http.StatusConflict, gin.H{"error": "Message is already pinned"})
+		return
+	}
+	if maxPins := maxPinnedMessages(); pinCount >= maxPins {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Conversation has reached maximum pinned message limit of %d", maxPins),
+		})
+		return
+	}
+
+	groupID := sql.NullInt64{Int64: int64(conv.groupID), Valid: conv.groupID != 0}
+	lowID := sql.NullInt64{Int64: int64(conv.lowID), Valid: conv.groupID == 0}
+	highID := sql.NullInt64{Int64: int64(conv.highID), Valid: conv.groupID == 0}
+	query = `INSERT INTO pinned_messages (message_id, group_id, user_low_id, user_high_id, pinned_by)
+		VALUES ($1, $2, $3, $4, $5)`
+	if _, err := tx.Exec(query, messageID, groupID, lowID, highID, int(userIDInt)); err != nil {
+		log.Printf("Error pinning message: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin message"})
+		return
+	}
+
+	if conv.groupID != 0 {
+		details := map[string]interface{}{"message_id": messageID}
+		if err := recordGroupEventTx(tx, conv.groupID, int(userIDInt), EventMessagePinned, 0, details); err != nil {
+			log.Printf("Error recording group event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin message"})
+			return
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin message"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Message pinned",
+		"message_id": messageID,
+	})
+}
+
+// UnpinMessageHandler removes a pin, under the same rules as pinning
+func UnpinMessageHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	messageID, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	conv, err := pinnableMessage(messageID, int(userIDInt))
+	if err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpin message"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpin message"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM pinned_messages WHERE message_id = $1`, messageID)
+	if err != nil {
+		log.Printf("Error unpinning message: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpin message"})
+		return
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message is not pinned"})
+		return
+	}
+
+	if conv.groupID != 0 {
+		details := map[string]interface{}{"message_id": messageID}
+		if err := recordGroupEventTx(tx, conv.groupID, int(userIDInt), EventMessageUnpinned, 0, details); err != nil {
+			log.Printf("Error recording group event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpin message"})
+			return
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpin message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message unpinned"})
+}
+
+// GetGroupPinsHandler lists a group's pinned messages (requires membership)
+func GetGroupPinsHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Same membership rules as reading the group's messages
+	groupID, _, ok := groupActionParam(c, int(userIDInt), PermViewGroup)
+	if !ok {
+		return
+	}
+
+	respondWithPins(c, `p.group_id = $2`, int(userIDInt), groupID)
+}
+
+// GetConversationPinsHandler lists the pinned messages of a DM conversation
+func GetConversationPinsHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	otherUserID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	lowID, highID := dmPair(int(userIDInt), otherUserID)
+	respondWithPins(c, `p.user_low_id = $2 AND p.user_high_id = $3`, int(userIDInt), lowID, highID)
+}
+
+// respondWithPins writes the pins matching filter, newest first. $1 is the caller,
+// whose held message requests stay hidden.
+func respondWithPins(c *gin.Context, filter string, userID int, args ...interface{}) {
+	query := `
+		SELECT ` + messageSelectColumns("$1") + `, p.pinned_by, p.pinned_at
+		FROM pinned_messages p
+		INNER JOIN messages m ON m.id = p.message_id
+		INNER JOIN users u ON u.id = m.sender_id
+		WHERE ` + filter + ` AND ` + heldMessageFilter + ` AND ` + unexpiredMessageFilter + `
+		ORDER BY p.pinned_at DESC`
+
+	rows, err := db.GetDB().Query(query, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pinned messages"})
+		return
+	}
+	defer rows.Close()
+
+	pins := []PinnedMessage{}
+	for rows.Next() {
+		var pin PinnedMessage
+		msg, err := scanMessage(rows, &pin.PinnedBy, &pin.PinnedAt)
+		if err != nil {
+			log.Printf("Error scanning pinned message: %v", err)
+			continue
+		}
+		pin.Message = msg
+		pins = append(pins, pin)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pins": pins})
+}
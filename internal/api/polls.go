@@ -0,0 +1,472 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// maxListedVoters is the most voters listed per option of a poll that isn't anonymous
+const maxListedVoters = 50
+
+// Poll is a group poll with its current tallies
+type Poll struct {
+	MessageID      int          `json:"message_id"`
+	GroupID        int          `json:"group_id"`
+	Question       string       `json:"question"`
+	Options        []PollOption `json:"options"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	Anonymous      bool         `json:"anonymous"`
+	ClosesAt       *time.Time   `json:"closes_at,omitempty"`
+	Closed         bool         `json:"closed"`
+	ClosedAt       *time.Time   `json:"closed_at,omitempty"`
+	CreatedBy      int          `json:"created_by"`
+	TotalVoters    int          `json:"total_voters"`
+	MyVotes        []int        `json:"my_votes"` // Indexes of the options the caller voted for
+}
+
+// PollOption is one option of a poll with its vote count
+type PollOption struct {
+	Index  int           `json:"index"`
+	Text   string        `json:"text"`
+	Votes  int           `json:"votes"`
+	Voters []UserSummary `json:"voters,omitempty"` // First voters, unless the poll is anonymous
+}
+
+// VoteRequest defines the structure for voting in a poll
+type VoteRequest struct {
+	OptionIndexes []int `json:"option_indexes" binding:"required"`
+}
+
+// pollRef is what the poll handlers need to check a request
+type pollRef struct {
+	id, groupID, createdBy int
+	multipleChoice         bool
+	optionCount            int
+}
+
+// createPollTx creates the poll behind a poll message inside tx
+func createPollTx(tx *sql.Tx, messageID, groupID, creatorID int, payload []byte) error {
+	var poll PollPayload
+	if err := json.Unmarshal(payload, &poll); err != nil {
+		return err
+	}
+
+	var closesAt *time.Time
+	if poll.ClosesAt != nil {
+		local := poll.ClosesAt.Local()
+		closesAt = &local
+	}
+
+	var pollID int
+	query := `INSERT INTO polls (message_id, group_id, created_by, question, multiple_choice, anonymous, closes_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`
+	err := tx.QueryRow(query, messageID, groupID, creatorID, poll.Question, poll.MultipleChoice, poll.Anonymous, closesAt).
+		Scan(&pollID)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO poll_options (poll_id, position, text)
+		SELECT $1, o.ord - 1, o.text FROM unnest($2::text[]) WITH ORDINALITY AS o(text, ord)`
+	_, err = tx.Exec(query, pollID, pq.Array(poll.Options))
+	return err
+}
+
+// checkScheduledPoll makes sure a scheduled poll is still open when it is delivered
+func checkScheduledPoll(msg outgoingMessage, sendAt time.Time) error {
+	if msg.messageType != MessageTypePoll {
+		return nil
+	}
+	var poll PollPayload
+	if err := json.Unmarshal(msg.payload, &poll); err != nil {
+		return err
+	}
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(sendAt) {
+		return &ValidationError{"closes_at must be after send_at"}
+	}
+	return nil
+}
+
+// pollForMessage loads the poll of a message, checking the user can read it with the
+// same rules as reading the group's messages
+func pollForMessage(messageID, userID int) (pollRef, error) {
+	var poll pollRef
+	query := `SELECT p.id, p.group_id, p.created_by, p.multiple_choice,
+			(SELECT COUNT(*) FROM poll_options o WHERE o.poll_id = p.id)
+		FROM polls p
+		INNER JOIN messages m ON m.id = p.message_id
+		WHERE p.message_id = $1 AND ` + unexpiredMessageFilter
+	err := db.GetDB().QueryRow(query, messageID).
+		Scan(&poll.id, &poll.groupID, &poll.createdBy, &poll.multipleChoice, &poll.optionCount)
+	if err == sql.ErrNoRows {
+		return poll, &NotFoundError{"Poll not found"}
+	}
+	if err != nil {
+		return poll, err
+	}
+
+	_, err = authorizeGroupAction(poll.groupID, userID, PermViewGroup)
+	return poll, err
+}
+
+// pollParam parses the :message_id URL parameter and loads its poll for the caller
+func pollParam(c *gin.Context, userID int, failure string) (pollRef, bool) {
+	messageID, ok := messageIDParam(c)
+	if !ok {
+		return pollRef{}, false
+	}
+
+	poll, err := pollForMessage(messageID, userID)
+	if err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return poll, false
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return poll, false
+	}
+	return poll, true
+}
+
+// pollResults loads a poll with its tallies as seen by userID
+func pollResults(pollID, userID int) (Poll, error) {
+	var poll Poll
+	query := `SELECT message_id, group_id, question, multiple_choice, anonymous, closes_at, closed_at, created_by,
+			closed_at IS NOT NULL OR COALESCE(closes_at <= $2, false),
+			(SELECT COUNT(DISTINCT user_id) FROM poll_votes WHERE poll_id = $1)
+		FROM polls
+		WHERE id = $1`
+	err := db.GetDB().QueryRow(query, pollID, time.Now()).Scan(&poll.MessageID, &poll.GroupID, &poll.Question,
+		&poll.MultipleChoice, &poll.Anonymous, &poll.ClosesAt, &poll.ClosedAt, &poll.CreatedBy, &poll.Closed, &poll.TotalVoters)
+	if err != nil {
+		return poll, err
+	}
+	// Past the deadline but not yet marked by the poll closer
+	if poll.Closed && poll.ClosedAt == nil {
+		poll.ClosedAt = poll.ClosesAt
+	}
+
+	query = `SELECT o.position, o.text, COUNT(v.user_id)
+		FROM poll_options o
+		LEFT JOIN poll_votes v ON v.poll_id = o.poll_id AND v.position = o.position
+		WHERE o.poll_id = $1
+		GROUP BY o.position, o.text
+		ORDER BY o.position`
+	rows, err := db.GetDB().Query(query, pollID)
+	if err != nil {
+		return poll, err
+	}
+	defer rows.Close()
+
+	poll.Options = []PollOption{}
+	for rows.Next() {
+		var option PollOption
+		if err := rows.Scan(&option.Index, &option.Text, &option.Votes); err != nil {
+			return poll, err
+		}
+		poll.Options = append(poll.Options, option)
+	}
+	if err := rows.Err(); err != nil {
+		return poll, err
+	}
+
+	poll.MyVotes = []int{}
+	query = `SELECT position FROM poll_votes WHERE poll_id = $1 AND user_id = $2 ORDER BY position`
+	voteRows, err := db.GetDB().Query(query, pollID, userID)
+	if err != nil {
+		return poll, err
+	}
+	defer voteRows.Close()
+	for voteRows.Next() {
+		var index int
+		if err := voteRows.Scan(&index); err != nil {
+			return poll, err
+		}
+		poll.MyVotes = append(poll.MyVotes, index)
+	}
+	if err := voteRows.Err(); err != nil {
+		return poll, err
+	}
+
+	if poll.Anonymous {
+		return poll, nil
+	}
+
+	query = `SELECT position, id, username, display_name, avatar_url FROM (
+			SELECT v.position, u.id, u.username, u.display_name, u.avatar_url,
+			       ROW_NUMBER() OVER (PARTITION BY v.position ORDER BY v.voted_at, v.user_id) AS rank
+			FROM poll_votes v
+			INNER JOIN users u ON u.id = v.user_id
+			WHERE v.poll_id = $1
+		) ranked
+		WHERE rank <= $2
+		ORDER BY position, rank`
+	voterRows, err := db.GetDB().Query(query, pollID, maxListedVoters)
+	if err != nil {
+		return poll, err
+	}
+	defer voterRows.Close()
+	for voterRows.Next() {
+		var index int
+		var voter UserSummary
+		if err := voterRows.Scan(&index, &voter.ID, &voter.Username, &voter.DisplayName, &voter.AvatarURL); err != nil {
+			return poll, err
+		}
+		if index >= 0 && index < len(poll.Options) {
+			poll.Options[index].Voters = append(poll.Options[index].Voters, voter)
+		}
+	}
+	return poll, voterRows.Err()
+}
+
+// respondWithPoll writes the poll with its current tallies
+func respondWithPoll(c *gin.Context, pollID, userID int, failure string) {
+	poll, err := pollResults(pollID, userID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"poll": poll})
+}
+
+// GetPollHandler returns a poll message's poll with its current tallies
+func GetPollHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	poll, ok := pollParam(c, int(userIDInt), "Failed to retrieve poll")
+	if !ok {
+		return
+	}
+
+	respondWithPoll(c, poll.id, int(userIDInt), "Failed to retrieve poll")
+}
+
+// VotePollHandler casts or changes the caller's vote. The given options replace any earlier vote.
+func VotePollHandler(c *gin.Context) {
+	var req VoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "option_indexes is required"})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	poll, ok := pollParam(c, int(userIDInt), "Failed to vote")
+	if !ok {
+		return
+	}
+
+	if len(req.OptionIndexes) == 0 || (!poll.multipleChoice && len(req.OptionIndexes) > 1) {
+		message := "Choose exactly one option"
+		if poll.multipleChoice {
+			message = "Choose at least one option"
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+	chosen := map[int]bool{}
+	for _, index := range req.OptionIndexes {
+		if index < 0 || index >= poll.optionCount || chosen[index] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "option_indexes must be distinct options of the poll"})
+			return
+		}
+		chosen[index] = true
+	}
+
+	if setVotes(c, poll, int(userIDInt), req.OptionIndexes, "Failed to vote") {
+		respondWithPoll(c, poll.id, int(userIDInt), "Failed to vote")
+	}
+}
+
+// RetractVoteHandler removes the caller's vote from an open poll
+func RetractVoteHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	poll, ok := pollParam(c, int(userIDInt), "Failed to retract vote")
+	if !ok {
+		return
+	}
+
+	if setVotes(c, poll, int(userIDInt), nil, "Failed to retract vote") {
+		respondWithPoll(c, poll.id, int(userIDInt), "Failed to retract vote")
+	}
+}
+
+// setVotes replaces the user's votes in an open poll. It writes the error response and
+// reports false when the votes couldn't be changed.
+func setVotes(c *gin.Context, poll pollRef, userID int, optionIndexes []int, failure string) bool {
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return false
+	}
+	defer tx.Rollback()
+
+	// One vote change per user at a time, so a single choice poll can't collect two votes
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, $2)`, poll.id, userID); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return false
+	}
+
+	// FOR SHARE holds off closing the poll until the vote is in
+	var open bool
+	query := `SELECT closed_at IS NULL AND (closes_at IS NULL OR closes_at > $2) FROM polls WHERE id = $1 FOR SHARE`
+	if err := tx.QueryRow(query, poll.id, time.Now()).Scan(&open); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return false
+	}
+	if !open {
+		c.JSON(http.StatusConflict, gin.H{"error": "Poll is closed"})
+		return false
+	}
+
+	query = `DELETE FROM poll_votes WHERE poll_id = $1 AND user_id = $2`
+	if _, err := tx.Exec(query, poll.id, userID); err != nil {
+		log.Printf("Error updating votes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return false
+	}
+
+	if len(optionIndexes) > 0 {
+		query = `INSERT INTO poll_votes (poll_id, position, user_id) SELECT $1, unnest($2::int[]), $3`
+		if _, err := tx.Exec(query, poll.id, pq.Array(optionIndexes), userID); err != nil {
+			log.Printf("Error updating votes: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+			return false
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return false
+	}
+	return true
+}
+
+// ClosePollHandler closes a poll before its deadline. The creator can close their own
+// polls; members with the close_polls permission can close any.
+func ClosePollHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	poll, ok := pollParam(c, int(userIDInt), "Failed to close poll")
+	if !ok {
+		return
+	}
+
+	if poll.createdBy != int(userIDInt) {
+		if _, err := authorizeGroupAction(poll.groupID, int(userIDInt), PermClosePolls); err != nil {
+			if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close poll"})
+			return
+		}
+	}
+
+	now := time.Now()
+	query := `UPDATE polls SET closed_at = $2, closed_by = $3
+		WHERE id = $1 AND closed_at IS NULL AND (closes_at IS NULL OR closes_at > $2)`
+	result, err := db.GetDB().Exec(query, poll.id, now, int(userIDInt))
+	if err != nil {
+		log.Printf("Error closing poll: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close poll"})
+		return
+	}
+	if closed, _ := result.RowsAffected(); closed == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Poll is already closed"})
+		return
+	}
+
+	respondWithPoll(c, poll.id, int(userIDInt), "Failed to close poll")
+}
+
+// StartPollCloser starts the background worker that closes polls at their deadline.
+// Votes are refused once closes_at passes even before the worker gets to the poll,
+// so the interval only affects when closed_at is filled in.
+func StartPollCloser() {
+	interval := getEnvDuration("POLL_CLOSER_INTERVAL", 30*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			closeExpiredPolls()
+		}
+	}()
+	log.Printf("Poll closer started (every %s)", interval)
+}
+
+// closeExpiredPolls marks open polls past their deadline as closed
+func closeExpiredPolls() {
+	query := `UPDATE polls SET closed_at = closes_at WHERE closed_at IS NULL AND closes_at <= $1`
+	result, err := db.GetDB().Exec(query, time.Now())
+	if err != nil {
+		log.Printf("Error closing expired polls: %v", err)
+		return
+	}
+	if closed, _ := result.RowsAffected(); closed > 0 {
+		log.Printf("Closed %d polls at their deadline", closed)
+	}
+}
@@ -0,0 +1,393 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DM privacy settings
+const (
+	PrivacyEveryone = "everyone"
+	PrivacyContacts = "contacts"
+	PrivacyNobody   = "nobody"
+)
+
+// UpdatePrivacyRequest defines the structure for changing the DM privacy setting
+type UpdatePrivacyRequest struct {
+	DMPrivacy string `json:"dm_privacy" binding:"required,oneof=everyone contacts nobody"`
+}
+
+// BlockedUser is an entry in the current user's block list
+type BlockedUser struct {
+	User      UserSummary `json:"user"`
+	BlockedAt time.Time   `json:"blocked_at"`
+}
+
+// isBlockedBy reports whether blockerID has blocked userID
+func isBlockedBy(blockerID, userID int) (bool, error) {
+	var blocked bool
+	query := `SELECT EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2)`
+	err := db.GetDB().QueryRow(query, blockerID, userID).Scan(&blocked)
+	return blocked, err
+}
+
+// checkUserInteraction enforces blocks and the target's DM privacy setting for an action
+// the actor performs on the target (sending a DM, adding them to a group). A block by the
+// target and a privacy denial produce the same error so blocks are not revealed.
+func checkUserInteraction(actorID, targetID int, action string) error {
+	var actorBlockedTarget, targetBlockedActor, isContact bool
+	var privacy string
+	query := `
+		SELECT
+			EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2),
+			EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id = $2 AND blocked_id = $1),
+			EXISTS(SELECT 1 FROM user_contacts WHERE owner_id = $2 AND contact_id = $1),
+			(SELECT dm_privacy FROM users WHERE id = $2)`
+	err := db.GetDB().QueryRow(query, actorID, targetID).Scan(&actorBlockedTarget, &targetBlockedActor, &isContact, &privacy)
+	if err != nil {
+		return err
+	}
+
+	if actorBlockedTarget {
+		return &ForbiddenError{"You have blocked this user, unblock them first"}
+	}
+
+	denied := &ForbiddenError{"This user does not allow you to " + action}
+	if targetBlockedActor {
+		return denied
+	}
+	switch privacy {
+	case PrivacyNobody:
+		return denied
+	case PrivacyContacts:
+		if !isContact {
+			return denied
+		}
+	}
+	return nil
+}
+
+// targetUserParam parses the :id URL parameter and rejects the caller's own ID
+func targetUserParam(c *gin.Context, userID int) (int, bool) {
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	if targetID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot do this to yourself"})
+		return 0, false
+	}
+
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`
+	if err := db.GetDB().QueryRow(query, targetID).Scan(&exists); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify user"})
+		return 0, false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return 0, false
+	}
+	return targetID, true
+}
+
+// UpdatePrivacyHandler changes who may DM the current user or add them to groups
+func UpdatePrivacyHandler(c *gin.Context) {
+	var req UpdatePrivacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dm_privacy must be one of: everyone, contacts, nobody"})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	query := `UPDATE users SET dm_privacy = $1 WHERE id = $2`
+	if _, err := db.GetDB().Exec(query, req.DMPrivacy, int(userIDInt)); err != nil {
+		log.Printf("Error updating privacy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Privacy settings updated",
+		"dm_privacy": req.DMPrivacy,
+	})
+}
+
+// BlockUserHandler adds a user to the current user's block list
+func BlockUserHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	targetID, ok := targetUserParam(c, int(userIDInt))
+	if !ok {
+		return
+	}
+
+	if err := blockUser(int(userIDInt), targetID); err != nil {
+		log.Printf("Error blocking user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked"})
+}
+
+// blockUser records a block and drops the blocked user from the blocker's contacts
+func blockUser(blockerID, blockedID int) error {
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err := tx.Exec(query, blockerID, blockedID); err != nil {
+		return err
+	}
+
+	query = `DELETE FROM user_contacts WHERE owner_id = $1 AND contact_id = $2`
+	if _, err := tx.Exec(query, blockerID, blockedID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnblockUserHandler removes a user from the current user's block list
+func UnblockUserHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	query := `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`
+	result, err := db.GetDB().Exec(query, int(userIDInt), targetID)
+	if err != nil {
+		log.Printf("Error unblocking user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not blocked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked"})
+}
+
+// GetBlockedUsersHandler lists the users the current user has blocked
+func GetBlockedUsersHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	query := `
+		SELECT u.id, u.username, u.display_name, u.avatar_url, b.created_at
+		FROM user_blocks b
+		INNER JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC`
+
+	rows, err := db.GetDB().Query(query, int(userIDInt))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve blocked users"})
+		return
+	}
+	defer rows.Close()
+
+	blocked := []BlockedUser{}
+	for rows.Next() {
+		var entry BlockedUser
+		err := rows.Scan(&entry.User.ID, &entry.User.Username, &entry.User.DisplayName, &entry.User.AvatarURL, &entry.BlockedAt)
+		if err != nil {
+			log.Printf("Error scanning blocked user: %v", err)
+			continue
+		}
+		blocked = append(blocked, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"blocked_users": blocked})
+}
+
+// AddContactHandler saves a user as one of the current user's contacts
+func AddContactHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	targetID, ok := targetUserParam(c, int(userIDInt))
+	if !ok {
+		return
+	}
+
+	query := `INSERT INTO user_contacts (owner_id, contact_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err := db.GetDB().Exec(query, int(userIDInt), targetID); err != nil {
+		log.Printf("Error adding contact: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add contact"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contact added"})
+}
+
+// RemoveContactHandler removes a user from the current user's contacts
+func RemoveContactHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	query := `DELETE FROM user_contacts WHERE owner_id = $1 AND contact_id = $2`
+	result, err := db.GetDB().Exec(query, int(userIDInt), targetID)
+	if err != nil {
+		log.Printf("Error removing contact: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove contact"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not in your contacts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contact removed"})
+}
+
+// GetContactsHandler lists the current user's saved contacts
+func GetContactsHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	query := `
+		SELECT u.id, u.username, u.display_name, u.avatar_url
+		FROM user_contacts uc
+		INNER JOIN users u ON u.id = uc.contact_id
+		WHERE uc.owner_id = $1
+		ORDER BY u.username ASC`
+
+	rows, err := db.GetDB().Query(query, int(userIDInt))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve contacts"})
+		return
+	}
+	defer rows.Close()
+
+	contacts := []UserSummary{}
+	for rows.Next() {
+		var contact UserSummary
+		if err := rows.Scan(&contact.ID, &contact.Username, &contact.DisplayName, &contact.AvatarURL); err != nil {
+			log.Printf("Error scanning contact: %v", err)
+			continue
+		}
+		contacts = append(contacts, contact)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"contacts": contacts})
+}
+
+// hidePresenceIfBlocked clears the status and profile details a blocker doesn't share
+// with the users they blocked
+func hidePresenceIfBlocked(profile *UserProfile, viewerID int) error {
+	if profile.ID == viewerID {
+		return nil
+	}
+
+	blocked, err := isBlockedBy(profile.ID, viewerID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		profile.StatusText = nil
+		profile.Bio = nil
+		profile.AvatarURL = nil
+	}
+	return nil
+}
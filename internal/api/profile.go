@@ -0,0 +1,217 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Profile field limits (match the column sizes in the users table)
+const (
+	maxDisplayNameLength = 100
+	maxBioLength         = 500
+	maxStatusTextLength  = 140
+	maxAvatarURLLength   = 2048
+)
+
+// UserSummary is the compact user info embedded in messages and member lists
+type UserSummary struct {
+	ID          int     `json:"id"`
+	Username    string  `json:"username"`
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+// UserProfile is the public profile of a user
+type UserProfile struct {
+	ID          int       `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName *string   `json:"display_name"`
+	AvatarURL   *string   `json:"avatar_url"`
+	Bio         *string   `json:"bio"`
+	StatusText  *string   `json:"status_text"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UpdateProfileRequest defines the structure for updating the current user's profile.
+// Omitted fields are left unchanged; an empty string clears a field.
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	AvatarURL   *string `json:"avatar_url,omitempty"`
+	Bio         *string `json:"bio,omitempty"`
+	StatusText  *string `json:"status_text,omitempty"`
+}
+
+// validateProfileText checks the length of a free-text profile field
+func validateProfileText(field string, value *string, maxLength int) error {
+	if value == nil {
+		return nil
+	}
+	if utf8.RuneCountInString(*value) > maxLength {
+		return &ValidationError{fmt.Sprintf("%s must be at most %d characters", field, maxLength)}
+	}
+	return nil
+}
+
+// validateAvatarURL accepts an empty value (clear) or an absolute http(s) URL
+func validateAvatarURL(value *string) error {
+	if value == nil || *value == "" {
+		return nil
+	}
+	if len(*value) > maxAvatarURLLength {
+		return &ValidationError{fmt.Sprintf("avatar_url must be at most %d characters", maxAvatarURLLength)}
+	}
+	parsed, err := url.Parse(*value)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return &ValidationError{"avatar_url must be an absolute http(s) URL"}
+	}
+	return nil
+}
+
+// UpdateProfileHandler updates the authenticated user's profile fields
+func UpdateProfileHandler(c *gin.Context) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Trim whitespace before validating
+	for _, field := range []*string{req.DisplayName, req.AvatarURL, req.Bio, req.StatusText} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+
+	validations := []error{
+		validateProfileText("display_name", req.DisplayName, maxDisplayNameLength),
+		validateAvatarURL(req.AvatarURL),
+		validateProfileText("bio", req.Bio, maxBioLength),
+		validateProfileText("status_text", req.StatusText, maxStatusTextLength),
+	}
+	for _, err := range validations {
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Build the SET clause from the provided fields only
+	var setClauses []string
+	var args []interface{}
+	addField := func(column string, value *string) {
+		if value == nil {
+			return
+		}
+		args = append(args, sql.NullString{String: *value, Valid: *value != ""})
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	addField("display_name", req.DisplayName)
+	addField("avatar_url", req.AvatarURL)
+	addField("bio", req.Bio)
+	addField("status_text", req.StatusText)
+
+	if len(setClauses) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No profile fields provided"})
+		return
+	}
+
+	args = append(args, int(userIDInt))
+	query := fmt.Sprintf(`UPDATE users SET %s WHERE id = $%d`, strings.Join(setClauses, ", "), len(args))
+	if _, err := db.GetDB().Exec(query, args...); err != nil {
+		log.Printf("Error updating profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	profile, err := fetchUserProfile(int(userIDInt))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Profile updated successfully",
+		"profile": profile,
+	})
+}
+
+// GetUserProfileHandler returns the public profile of any user
+func GetUserProfileHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Get user ID from URL parameter
+	profileID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	profile, err := fetchUserProfile(profileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+
+	// Users who blocked the viewer don't share their status with them
+	if err := hidePresenceIfBlocked(profile, int(userIDInt)); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// fetchUserProfile loads a user's public profile
+func fetchUserProfile(userID int) (*UserProfile, error) {
+	var profile UserProfile
+	query := `SELECT id, username, display_name, avatar_url, bio, status_text, created_at
+		FROM users WHERE id = $1`
+	err := db.GetDB().QueryRow(query, userID).Scan(&profile.ID, &profile.Username, &profile.DisplayName,
+		&profile.AvatarURL, &profile.Bio, &profile.StatusText, &profile.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
@@ -0,0 +1,487 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"messaging-system/internal/push"
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pushDeliveryLease is how long a claimed delivery stays hidden from other dispatchers.
+// A dispatcher that dies mid-send leaves it to be retried after the lease.
+const pushDeliveryLease = 5 * time.Minute
+
+// maxPushBackoff caps the delay between delivery attempts
+const maxPushBackoff = time.Hour
+
+// maxPushBodyLength is the longest message excerpt shown in a notification, in runes
+const maxPushBodyLength = 200
+
+// pushWakeup lets senders start the dispatcher right away instead of at the next tick
+var pushWakeup = make(chan struct{}, 1)
+
+// RegisterDeviceRequest defines the structure for registering a device for push notifications
+type RegisterDeviceRequest struct {
+	Platform string `json:"platform" binding:"required"` // fcm, apns or webpush
+	Token    string `json:"token" binding:"required"`    // The push subscription JSON for webpush
+}
+
+// PushDevice is a device registered for push notifications
+type PushDevice struct {
+	ID         int       `json:"id"`
+	Platform   string    `json:"platform"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// pushNotificationsEnabled reports whether new messages are pushed to devices. Without a
+// configured provider messages aren't queued for pushing at all.
+func pushNotificationsEnabled() bool {
+	return getEnvBool("PUSH_NOTIFICATIONS_ENABLED", true) && push.GetProvider() != nil
+}
+
+// maxPushDevices is the number of devices a user can register; the least recently
+// seen ones are dropped past it
+func maxPushDevices() int {
+	return getEnvInt("MAX_PUSH_DEVICES", 10)
+}
+
+// wakePushDispatcher nudges the dispatcher after a message is stored
+func wakePushDispatcher() {
+	select {
+	case pushWakeup <- struct{}{}:
+	default:
+		// A wakeup is already pending
+	}
+}
+
+// RegisterDeviceHandler registers (or refreshes) a device token of the current user
+func RegisterDeviceHandler(c *gin.Context) {
+	var req RegisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := push.ValidateToken(req.Platform, req.Token); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+	defer tx.Rollback()
+
+	// A token that moves to another account must not receive the previous owner's notifications
+	query := `DELETE FROM push_deliveries WHERE device_id IN (
+			SELECT id FROM push_devices WHERE platform = $1 AND token = $2 AND user_id <> $3)`
+	if _, err := tx.Exec(query, req.Platform, req.Token, int(userIDInt)); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+
+	var device PushDevice
+	query = `INSERT INTO push_devices (user_id, platform, token) VALUES ($1, $2, $3)
+		ON CONFLICT (platform, token) DO UPDATE SET user_id = EXCLUDED.user_id, last_seen_at = NOW()
+		RETURNING id, platform, created_at, last_seen_at`
+	err = tx.QueryRow(query, int(userIDInt), req.Platform, req.Token).
+		Scan(&device.ID, &device.Platform, &device.CreatedAt, &device.LastSeenAt)
+	if err != nil {
+		log.Printf("Error registering device: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+
+	// Forget the least recently seen devices past the limit
+	query = `DELETE FROM push_devices WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM push_devices WHERE user_id = $1 ORDER BY last_seen_at DESC, id DESC LIMIT $2)`
+	if _, err := tx.Exec(query, int(userIDInt), maxPushDevices()); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Device registered",
+		"device":  device,
+	})
+}
+
+// GetDevicesHandler lists the devices the current user registered
+func GetDevicesHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	query := `SELECT id, platform, created_at, last_seen_at FROM push_devices
+		WHERE user_id = $1
+		ORDER BY last_seen_at DESC`
+	rows, err := db.GetDB().Query(query, int(userIDInt))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve devices"})
+		return
+	}
+	defer rows.Close()
+
+	devices := []PushDevice{}
+	for rows.Next() {
+		var device PushDevice
+		if err := rows.Scan(&device.ID, &device.Platform, &device.CreatedAt, &device.LastSeenAt); err != nil {
+			log.Printf("Error scanning device: %v", err)
+			continue
+		}
+		devices = append(devices, device)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+// DeleteDeviceHandler unregisters one of the current user's devices, e.g. on logout
+func DeleteDeviceHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	deviceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+
+	query := `DELETE FROM push_devices WHERE id = $1 AND user_id = $2`
+	result, err := db.GetDB().Exec(query, deviceID, int(userIDInt))
+	if err != nil {
+		log.Printf("Error deleting device: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device deleted"})
+}
+
+// StartPushDispatcher starts the background worker that pushes new messages to the
+// recipients' devices. Recipients are worked out in bulk from the message's conversation,
+// and each device gets its own delivery that is retried with backoff.
+func StartPushDispatcher() {
+	if !pushNotificationsEnabled() {
+		log.Printf("Push notifications disabled (PUSH_NOTIFICATIONS_ENABLED is off or no provider is configured)")
+		return
+	}
+
+	provider := push.GetProvider()
+	interval := getEnvDuration("PUSH_DISPATCH_INTERVAL", 10*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-pushWakeup:
+			}
+			fanOutPushNotifications()
+			deliverPushNotifications(provider)
+		}
+	}()
+	log.Printf("Push dispatcher started (every %s)", interval)
+}
+
+// pushBatchSize is the most messages fanned out, or deliveries sent, per statement
+func pushBatchSize() int {
+	return getEnvInt("PUSH_BATCH_SIZE", 500)
+}
+
+// fanOutPushNotifications turns new messages into one delivery per recipient device.
+// DMs notify the receiver unless held as a message request; group messages notify every
+// other member. Muted conversations, level none, and level mentions without a mention
+// of the member are skipped.
+func fanOutPushNotifications() {
+	for {
+		query := `
+			WITH claimed AS (
+			    UPDATE messages SET push_pending = false
+			    WHERE id IN (
+			        SELECT id FROM messages
+			        WHERE push_pending
+			        ORDER BY id
+			        LIMIT $1
+			        FOR NO KEY UPDATE SKIP LOCKED)
+			    RETURNING id, sender_id, receiver_id, group_id
+			), recipients AS (
+			    SELECT c.id AS message_id, c.receiver_id AS user_id
+			    FROM claimed c
+			    LEFT JOIN conversation_settings s ON s.user_id = c.receiver_id AND s.peer_id = c.sender_id
+			    WHERE c.receiver_id IS NOT NULL
+			      AND NOT ` + mutedSettingFilter("$2") + `
+			      AND COALESCE(s.notification_level, 'all') <> 'none'
+			      AND NOT EXISTS (
+			          SELECT 1 FROM message_requests r
+			          WHERE r.receiver_id = c.receiver_id AND r.sender_id = c.sender_id AND r.status <> 'accepted')
+			    UNION ALL
+			    SELECT c.id, gm.member_id
+			    FROM claimed c
+			    INNER JOIN group_members gm ON gm.group_id = c.group_id AND gm.member_id <> c.sender_id
+			    LEFT JOIN conversation_settings s ON s.user_id = gm.member_id AND s.group_id = c.group_id
+			    WHERE NOT ` + mutedSettingFilter("$2") + `
+			      AND (COALESCE(s.notification_level, 'all') = 'all'
+			           OR (s.notification_level = 'mentions' AND EXISTS (
+			               SELECT 1 FROM message_mentions mm WHERE mm.message_id = c.id AND mm.user_id = gm.member_id)))
+			), queued AS (
+			    INSERT INTO push_deliveries (message_id, device_id, next_attempt_at)
+			    SELECT r.message_id, d.id, $2
+			    FROM recipients r
+			    INNER JOIN push_devices d ON d.user_id = r.user_id
+			    ON CONFLICT (message_id, device_id) DO NOTHING
+			)
+			SELECT COUNT(*) FROM claimed`
+
+		var claimed int
+		if err := db.GetDB().QueryRow(query, pushBatchSize(), time.Now()).Scan(&claimed); err != nil {
+			log.Printf("Error fanning out push notifications: %v", err)
+			return
+		}
+		if claimed < pushBatchSize() {
+			return
+		}
+	}
+}
+
+// pushJob is a claimed delivery with what is needed to send it
+type pushJob struct {
+	deliveryID int64
+	attempts   int
+	deviceID   int
+	device     push.Device
+	messageID  int
+	senderID   int
+	groupID    *int
+	content    string
+	senderName string
+	groupName  *string
+	expiresAt  *time.Time
+}
+
+// deliverPushNotifications sends due deliveries batch by batch
+func deliverPushNotifications(provider push.Provider) {
+	concurrency := getEnvInt("PUSH_CONCURRENCY", 8)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	for {
+		jobs, err := claimPushJobs()
+		if err != nil {
+			log.Printf("Error claiming push deliveries: %v", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, concurrency)
+		for _, job := range jobs {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(job pushJob) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				sendPushJob(provider, job)
+			}(job)
+		}
+		wg.Wait()
+
+		if len(jobs) < pushBatchSize() {
+			return
+		}
+	}
+}
+
+// claimPushJobs leases due deliveries, counting the attempt up front
+func claimPushJobs() ([]pushJob, error) {
+	now := time.Now()
+	query := `
+		WITH claimed AS (
+		    UPDATE push_deliveries SET attempts = attempts + 1, next_attempt_at = $2
+		    WHERE id IN (
+		        SELECT id FROM push_deliveries
+		        WHERE next_attempt_at <= $1
+		        ORDER BY next_attempt_at, id
+		        LIMIT $3
+		        FOR UPDATE SKIP LOCKED)
+		    RETURNING id, attempts, message_id, device_id
+		)
+		SELECT c.id, c.attempts, d.id, d.platform, d.token, m.id, m.sender_id, m.group_id, m.content,
+		       COALESCE(NULLIF(u.display_name, ''), u.username), g.group_name, m.expires_at
+		FROM claimed c
+		INNER JOIN push_devices d ON d.id = c.device_id
+		INNER JOIN messages m ON m.id = c.message_id
+		INNER JOIN users u ON u.id = m.sender_id
+		LEFT JOIN groups g ON g.id = m.group_id`
+	rows, err := db.GetDB().Query(query, now, now.Add(pushDeliveryLease), pushBatchSize())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []pushJob
+	for rows.Next() {
+		var job pushJob
+		err := rows.Scan(&job.deliveryID, &job.attempts, &job.deviceID, &job.device.Platform, &job.device.Token,
+			&job.messageID, &job.senderID, &job.groupID, &job.content, &job.senderName, &job.groupName, &job.expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// sendPushJob sends one delivery and records the outcome: delivered and permanently failed
+// deliveries are removed, dead tokens take their device with them, and temporary failures
+// are retried with exponential backoff until PUSH_MAX_ATTEMPTS
+func sendPushJob(provider push.Provider, job pushJob) {
+	// A disappearing message that expired while queued isn't worth announcing
+	if job.expiresAt != nil && job.expiresAt.Before(time.Now()) {
+		finishPushDelivery(job.deliveryID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	err := provider.Send(ctx, job.device, pushNotificationFor(job))
+	if err == nil {
+		finishPushDelivery(job.deliveryID)
+		return
+	}
+
+	if errors.Is(err, push.ErrUnregistered) {
+		query := `DELETE FROM push_devices WHERE id = $1`
+		if _, err := db.GetDB().Exec(query, job.deviceID); err != nil {
+			log.Printf("Error deleting push device: %v", err)
+		}
+		return
+	}
+
+	retryable, retryAfter := push.Retryable(err)
+	if !retryable || job.attempts >= getEnvInt("PUSH_MAX_ATTEMPTS", 5) {
+		log.Printf("Giving up on push notification for message %d after %d attempts: %v", job.messageID, job.attempts, err)
+		finishPushDelivery(job.deliveryID)
+		return
+	}
+
+	delay := pushBackoff(job.attempts)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	query := `UPDATE push_deliveries SET next_attempt_at = $1 WHERE id = $2`
+	if _, err := db.GetDB().Exec(query, time.Now().Add(delay), job.deliveryID); err != nil {
+		log.Printf("Error rescheduling push delivery: %v", err)
+	}
+}
+
+// pushBackoff is the delay after the given number of failed attempts: PUSH_RETRY_BASE,
+// doubling each time, with up to 20% jitter so retries of a burst spread out
+func pushBackoff(attempts int) time.Duration {
+	delay := getEnvDuration("PUSH_RETRY_BASE", 30*time.Second)
+	for i := 1; i < attempts && delay < maxPushBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxPushBackoff {
+		delay = maxPushBackoff
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// finishPushDelivery removes a delivery that needs no more attempts
+func finishPushDelivery(deliveryID int64) {
+	query := `DELETE FROM push_deliveries WHERE id = $1`
+	if _, err := db.GetDB().Exec(query, deliveryID); err != nil {
+		log.Printf("Error finishing push delivery: %v", err)
+	}
+}
+
+// pushNotificationFor renders the notification of a delivery. PUSH_SHOW_PREVIEW=false
+// keeps message content off lock screens and out of the push services.
+func pushNotificationFor(job pushJob) push.Notification {
+	body := job.content
+	if !getEnvBool("PUSH_SHOW_PREVIEW", true) {
+		body = "New message"
+	}
+	if runes := []rune(body); len(runes) > maxPushBodyLength {
+		body = string(runes[:maxPushBodyLength-1]) + "…"
+	}
+
+	n := push.Notification{
+		Title:    job.senderName,
+		Body:     body,
+		ThreadID: fmt.Sprintf("dm-%d", job.senderID),
+		Data: map[string]string{
+			"message_id": strconv.Itoa(job.messageID),
+			"sender_id":  strconv.Itoa(job.senderID),
+		},
+	}
+	if job.groupID != nil {
+		if job.groupName != nil {
+			n.Title = *job.groupName
+		}
+		n.Body = job.senderName + ": " + body
+		n.ThreadID = fmt.Sprintf("group-%d", *job.groupID)
+		n.Data["group_id"] = strconv.Itoa(*job.groupID)
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushBackoff(t *testing.T) {
+	t.Setenv("PUSH_RETRY_BASE", "30s")
+
+	tests := []struct {
+		attempts int
+		base     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{8, maxPushBackoff},
+		{100, maxPushBackoff},
+	}
+	for _, tt := range tests {
+		// Jitter adds up to a fifth of the delay
+		for i := 0; i < 50; i++ {
+			delay := pushBackoff(tt.attempts)
+			if delay < tt.base || delay > tt.base+tt.base/5 {
+				t.Fatalf("pushBackoff(%d) = %s, want between %s and %s", tt.attempts, delay, tt.base, tt.base+tt.base/5)
+			}
+		}
+	}
+}
+
+func TestPushNotificationForDirectMessage(t *testing.T) {
+	job := pushJob{messageID: 7, senderID: 3, content: "See you at 8", senderName: "Alice"}
+
+	n := pushNotificationFor(job)
+	if n.Title != "Alice" || n.Body != "See you at 8" || n.ThreadID != "dm-3" {
+		t.Errorf("got %+v", n)
+	}
+	if n.Data["message_id"] != "7" || n.Data["sender_id"] != "3" {
+		t.Errorf("data = %v", n.Data)
+	}
+	if _, ok := n.Data["group_id"]; ok {
+		t.Error("DM notification has a group_id")
+	}
+}
+
+func TestPushNotificationForGroupMessage(t *testing.T) {
+	groupID, groupName := 12, "Climbing"
+	job := pushJob{messageID: 7, senderID: 3, groupID: &groupID, groupName: &groupName, content: "Who's in?", senderName: "Alice"}
+
+	n := pushNotificationFor(job)
+	if n.Title != "Climbing" || n.Body != "Alice: Who's in?" || n.ThreadID != "group-12" || n.Data["group_id"] != "12" {
+		t.Errorf("got %+v", n)
+	}
+}
+
+func TestPushNotificationForHidesContent(t *testing.T) {
+	t.Setenv("PUSH_SHOW_PREVIEW", "false")
+	groupID, groupName := 12, "Climbing"
+	job := pushJob{messageID: 7, senderID: 3, groupID: &groupID, groupName: &groupName, content: "The door code is 4711", senderName: "Alice"}
+
+	n := pushNotificationFor(job)
+	if n.Body != "Alice: New message" || strings.Contains(n.Title+n.Body, "4711") {
+		t.Errorf("got %+v, want the content hidden", n)
+	}
+}
+
+func TestPushNotificationForLongMessage(t *testing.T) {
+	job := pushJob{messageID: 7, senderID: 3, content: strings.Repeat("ü", 500), senderName: "Alice"}
+
+	n := pushNotificationFor(job)
+	if runes := []rune(n.Body); len(runes) != maxPushBodyLength || runes[len(runes)-1] != '…' {
+		t.Errorf("body has %d runes, want %d ending in an ellipsis", len(runes), maxPushBodyLength)
+	}
+}
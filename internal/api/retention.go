@@ -0,0 +1,461 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Retention actions
+const (
+	RetentionDelete  = "delete"
+	RetentionArchive = "archive"
+)
+
+// legalHoldFilter keeps messages sent or received by a user on hold, or sent in a group
+// on hold. It expects messages aliased as m.
+const legalHoldFilter = `NOT EXISTS (
+		    SELECT 1 FROM legal_holds h
+		    WHERE h.released_at IS NULL
+		      AND (h.group_id = m.group_id OR h.user_id = m.sender_id OR h.user_id = m.receiver_id)
+		)`
+
+// RetentionPolicy is a server-wide (GroupID nil) or per-group retention window
+type RetentionPolicy struct {
+	ID         int       `json:"id"`
+	GroupID    *int      `json:"group_id"`
+	RetainDays int       `json:"retain_days"`
+	Action     string    `json:"action"`
+	UpdatedBy  *int      `json:"updated_by"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SetRetentionPolicyRequest defines the structure for creating or replacing a retention policy
+type SetRetentionPolicyRequest struct {
+	GroupID    *int   `json:"group_id,omitempty"` // Omit for the server-wide policy
+	RetainDays int    `json:"retain_days" binding:"required,min=1"`
+	Action     string `json:"action,omitempty" binding:"omitempty,oneof=delete archive"`
+}
+
+// LegalHold exempts a user's or a group's messages from retention
+type LegalHold struct {
+	ID        int       `json:"id"`
+	UserID    *int      `json:"user_id,omitempty"`
+	GroupID   *int      `json:"group_id,omitempty"`
+	Reason    string    `json:"reason"`
+	CreatedBy *int      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateLegalHoldRequest defines the structure for placing a legal hold
+type CreateLegalHoldRequest struct {
+	UserID  *int   `json:"user_id,omitempty"`
+	GroupID *int   `json:"group_id,omitempty"`
+	Reason  string `json:"reason" binding:"required,max=500"`
+}
+
+// RetentionReportEntry is what a policy would purge if it ran now
+type RetentionReportEntry struct {
+	Policy          RetentionPolicy `json:"policy"`
+	Cutoff          time.Time       `json:"cutoff"`
+	MatchingCount   int             `json:"matching_messages"` // Would be deleted or archived
+	HeldCount       int             `json:"held_messages"`     // Past the cutoff but kept by legal holds
+	OldestMessageAt *time.Time      `json:"oldest_message_at"`
+}
+
+// retentionScope restricts messages to those a policy governs. Group policies use
+// groupParam for the group ID; the server-wide policy covers DMs and groups without
+// a policy of their own.
+func retentionScope(policy RetentionPolicy, groupParam string) string {
+	if policy.GroupID != nil {
+		return `m.group_id = ` + groupParam
+	}
+	return `(m.group_id IS NULL OR NOT EXISTS (SELECT 1 FROM retention_policies rp WHERE rp.group_id = m.group_id))`
+}
+
+// retentionCutoff is the creation time before which a policy's messages are purged
+func retentionCutoff(policy RetentionPolicy) time.Time {
+	return time.Now().AddDate(0, 0, -policy.RetainDays)
+}
+
+// loadRetentionPolicies returns every policy, group policies first
+func loadRetentionPolicies() ([]RetentionPolicy, error) {
+	query := `SELECT id, group_id, retain_days, action, updated_by, updated_at
+		FROM retention_policies
+		ORDER BY group_id NULLS LAST`
+	rows, err := db.GetDB().Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []RetentionPolicy{}
+	for rows.Next() {
+		var p RetentionPolicy
+		if err := rows.Scan(&p.ID, &p.GroupID, &p.RetainDays, &p.Action, &p.UpdatedBy, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// GetRetentionPoliciesHandler lists the retention policies (admin only)
+func GetRetentionPoliciesHandler(c *gin.Context) {
+	policies, err := loadRetentionPolicies()
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve retention policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+// SetRetentionPolicyHandler creates or replaces the server-wide policy, or a group's policy (admin only)
+func SetRetentionPolicyHandler(c *gin.Context) {
+	var req SetRetentionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Action == "" {
+		req.Action = RetentionDelete
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var query string
+	if req.GroupID != nil {
+		var groupExists bool
+		query = `SELECT EXISTS(SELECT 1 FROM groups WHERE id = $1)`
+		if err := db.GetDB().QueryRow(query, *req.GroupID).Scan(&groupExists); err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save retention policy"})
+			return
+		}
+		if !groupExists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+
+		query = `INSERT INTO retention_policies (group_id, retain_days, action, updated_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (group_id)
+			DO UPDATE SET retain_days = EXCLUDED.retain_days, action = EXCLUDED.action,
+			              updated_by = EXCLUDED.updated_by, updated_at = NOW()
+			RETURNING id, group_id, retain_days, action, updated_by, updated_at`
+	} else {
+		query = `INSERT INTO retention_policies (group_id, retain_days, action, updated_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT ((group_id IS NULL)) WHERE group_id IS NULL
+			DO UPDATE SET retain_days = EXCLUDED.retain_days, action = EXCLUDED.action,
+			              updated_by = EXCLUDED.updated_by, updated_at = NOW()
+			RETURNING id, group_id, retain_days, action, updated_by, updated_at`
+	}
+
+	var policy RetentionPolicy
+	err := db.GetDB().QueryRow(query, req.GroupID, req.RetainDays, req.Action, int(userIDInt)).
+		Scan(&policy.ID, &policy.GroupID, &policy.RetainDays, &policy.Action, &policy.UpdatedBy, &policy.UpdatedAt)
+	if err != nil {
+		log.Printf("Error saving retention policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save retention policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policy})
+}
+
+// DeleteRetentionPolicyHandler removes a retention policy (admin only)
+func DeleteRetentionPolicyHandler(c *gin.Context) {
+	policyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy ID"})
+		return
+	}
+
+	result, err := db.GetDB().Exec(`DELETE FROM retention_policies WHERE id = $1`, policyID)
+	if err != nil {
+		log.Printf("Error deleting retention policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete retention policy"})
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Retention policy not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Retention policy deleted"})
+}
+
+// GetLegalHoldsHandler lists the active legal holds (admin only)
+func GetLegalHoldsHandler(c *gin.Context) {
+	query := `SELECT id, user_id, group_id, reason, created_by, created_at
+		FROM legal_holds
+		WHERE released_at IS NULL
+		ORDER BY created_at DESC`
+
+	rows, err := db.GetDB().Query(query)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve legal holds"})
+		return
+	}
+	defer rows.Close()
+
+	holds := []LegalHold{}
+	for rows.Next() {
+		var hold LegalHold
+		err := rows.Scan(&hold.ID, &hold.UserID, &hold.GroupID, &hold.Reason, &hold.CreatedBy, &hold.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning legal hold: %v", err)
+			continue
+		}
+		holds = append(holds, hold)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"legal_holds": holds})
+}
+
+// CreateLegalHoldHandler places a legal hold on a user or a group (admin only)
+func CreateLegalHoldHandler(c *gin.Context) {
+	var req CreateLegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.UserID == nil) == (req.GroupID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either user_id or group_id must be provided, but not both"})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var subjectExists bool
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`
+	subjectID, notFound := req.UserID, "User not found"
+	if req.GroupID != nil {
+		query = `SELECT EXISTS(SELECT 1 FROM groups WHERE id = $1)`
+		subjectID, notFound = req.GroupID, "Group not found"
+	}
+	if err := db.GetDB().QueryRow(query, *subjectID).Scan(&subjectExists); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place legal hold"})
+		return
+	}
+	if !subjectExists {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return
+	}
+
+	var hold LegalHold
+	query = `INSERT INTO legal_holds (user_id, group_id, reason, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, group_id, reason, created_by, created_at`
+	err := db.GetDB().QueryRow(query, req.UserID, req.GroupID, req.Reason, int(userIDInt)).
+		Scan(&hold.ID, &hold.UserID, &hold.GroupID, &hold.Reason, &hold.CreatedBy, &hold.CreatedAt)
+	if err != nil {
+		log.Printf("Error placing legal hold: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place legal hold"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"legal_hold": hold})
+}
+
+// ReleaseLegalHoldHandler releases a legal hold (admin only). Released holds are kept for the record.
+func ReleaseLegalHoldHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	holdID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid legal hold ID"})
+		return
+	}
+
+	query := `UPDATE legal_holds SET released_at = NOW(), released_by = $1
+		WHERE id = $2 AND released_at IS NULL`
+	result, err := db.GetDB().Exec(query, int(userIDInt), holdID)
+	if err != nil {
+		log.Printf("Error releasing legal hold: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release legal hold"})
+		return
+	}
+	if released, _ := result.RowsAffected(); released == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Active legal hold not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Legal hold released"})
+}
+
+// GetRetentionReportHandler reports what each policy would purge if it ran now,
+// without changing anything (admin only)
+func GetRetentionReportHandler(c *gin.Context) {
+	policies, err := loadRetentionPolicies()
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build retention report"})
+		return
+	}
+
+	entries := []RetentionReportEntry{}
+	for _, policy := range policies {
+		entry := RetentionReportEntry{Policy: policy, Cutoff: retentionCutoff(policy)}
+
+		args := []interface{}{entry.Cutoff}
+		if policy.GroupID != nil {
+			args = append(args, *policy.GroupID)
+		}
+		query := `
+			SELECT COUNT(*) FILTER (WHERE ` + legalHoldFilter + `),
+			       COUNT(*) FILTER (WHERE NOT ` + legalHoldFilter + `),
+			       MIN(m.created_at) FILTER (WHERE ` + legalHoldFilter + `)
+			FROM messages m
+			WHERE m.created_at < $1 AND ` + retentionScope(policy, "$2")
+
+		err := db.GetDB().QueryRow(query, args...).Scan(&entry.MatchingCount, &entry.HeldCount, &entry.OldestMessageAt)
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build retention report"})
+			return
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":      true,
+		"generated_at": time.Now(),
+		"policies":     entries,
+	})
+}
+
+// StartRetentionPurger starts the background worker that applies retention policies.
+// It deletes (or archives) in small batches, each its own short statement, so it never
+// holds long locks on messages; rows are claimed with SKIP LOCKED so replicas can share the work.
+func StartRetentionPurger() {
+	interval := getEnvDuration("RETENTION_PURGE_INTERVAL", time.Hour)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runRetentionPurge()
+		}
+	}()
+	log.Printf("Retention purger started (every %s)", interval)
+}
+
+// runRetentionPurge applies every retention policy once
+func runRetentionPurge() {
+	policies, err := loadRetentionPolicies()
+	if err != nil {
+		log.Printf("Error loading retention policies: %v", err)
+		return
+	}
+
+	for _, policy := range policies {
+		purged, err := purgePolicy(policy)
+		if err != nil {
+			log.Printf("Error applying retention policy %d: %v", policy.ID, err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Retention policy %d (%s): purged %d messages", policy.ID, policy.Action, purged)
+		}
+	}
+}
+
+// purgePolicy deletes or archives the messages a policy has expired, batch by batch,
+// and returns how many it removed
+func purgePolicy(policy RetentionPolicy) (int64, error) {
+	batchSize := getEnvInt("RETENTION_PURGE_BATCH", 1000)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	pause := getEnvDuration("RETENTION_BATCH_PAUSE", 100*time.Millisecond)
+
+	args := []interface{}{retentionCutoff(policy), batchSize, policy.Action == RetentionArchive, policy.ID}
+	if policy.GroupID != nil {
+		args = append(args, *policy.GroupID)
+	}
+
+	// The archive copy and the delete run in one statement, so a message is never lost
+	// or archived twice
+	query := `
+		WITH batch AS (
+			SELECT m.id FROM messages m
+			WHERE m.created_at < $1 AND ` + retentionScope(policy, "$5") + ` AND ` + legalHoldFilter + `
+			ORDER BY m.created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		), archived AS (
+			INSERT INTO archived_messages (id, sender_id, receiver_id, group_id, content, message_type, payload, created_at, policy_id)
+			SELECT m.id, m.sender_id, m.receiver_id, m.group_id, m.content, m.message_type, m.payload, m.created_at, $4
+			FROM messages m
+			WHERE $3 AND m.id IN (SELECT id FROM batch)
+			ON CONFLICT (id) DO NOTHING
+		)
+		DELETE FROM messages WHERE id IN (SELECT id FROM batch)`
+
+	var total int64
+	for {
+		result, err := db.GetDB().Exec(query, args...)
+		if err != nil {
+			return total, err
+		}
+		purged, _ := result.RowsAffected()
+		total += purged
+		if purged < int64(batchSize) {
+			return total, nil
+		}
+		time.Sleep(pause)
+	}
+}
+
+// groupUnderLegalHold reports whether a group has an active legal hold, or holds any
+// message sent by a user on hold
+func groupUnderLegalHold(groupID int) (bool, error) {
+	var held bool
+	query := `SELECT EXISTS(SELECT 1 FROM legal_holds WHERE group_id = $1 AND released_at IS NULL)
+		OR EXISTS(SELECT 1 FROM messages m WHERE m.group_id = $1 AND NOT ` + legalHoldFilter + `)`
+	err := db.GetDB().QueryRow(query, groupID).Scan(&held)
+	return held, err
+}
@@ -0,0 +1,376 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"messaging-system/internal/richtext"
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Limits for structured message payloads
+const (
+	maxPlaceNameLength    = 100
+	maxAddressLength      = 200
+	maxContactNameLength  = 100
+	maxPollQuestionLength = 300
+	maxPollOptionLength   = 100
+	minPollOptions        = 2
+	maxPollOptions        = 10
+)
+
+// Page sizes for the mentions feed
+const (
+	defaultMentionsLimit = 20
+	maxMentionsLimit     = 100
+)
+
+// LocationPayload is the payload of a location message
+type LocationPayload struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Name      string   `json:"name,omitempty"`
+	Address   string   `json:"address,omitempty"`
+}
+
+// ContactPayload is the payload of a contact card message. At least one way to
+// reach the contact is required.
+type ContactPayload struct {
+	Name     string `json:"name"`
+	MobileNo string `json:"mobile_no,omitempty"`
+	Email    string `json:"email,omitempty"`
+	UserID   *int   `json:"user_id,omitempty"` // Set when the contact has an account here
+}
+
+// PollPayload is the payload of a poll message
+type PollPayload struct {
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	ClosesAt       *time.Time `json:"closes_at,omitempty"`
+}
+
+// outgoingMessage is a validated message ready to be stored
+type outgoingMessage struct {
+	content         string
+	messageType     string
+	payload         []byte // Normalized JSON, nil for text and markdown
+	clientMessageID string
+	linkPreview     []byte         // Copied along when forwarding instead of fetched again
+	forwardedFrom   *forwardOrigin // Set on forwarded copies
+}
+
+// prepareOutgoingMessage validates the type and payload of a send request. Structured
+// messages sent without content get a text fallback for clients that can't render them.
+func prepareOutgoingMessage(req SendMessageRequest, clientMessageID string) (outgoingMessage, error) {
+	msg := outgoingMessage{content: req.Content, messageType: req.MessageType, clientMessageID: clientMessageID}
+	if msg.messageType == "" {
+		msg.messageType = MessageTypeText
+	}
+
+	var payload interface{}
+	var fallback string
+	switch msg.messageType {
+	case MessageTypeText, MessageTypeMarkdown:
+		if len(req.Payload) > 0 {
+			return msg, &ValidationError{"payload is only allowed for location, contact and poll messages"}
+		}
+		if strings.TrimSpace(msg.content) == "" {
+			return msg, &ValidationError{"content is required"}
+		}
+		return msg, nil
+
+	case MessageTypeLocation:
+		var location LocationPayload
+		if err := decodePayload(req.Payload, &location); err != nil {
+			return msg, err
+		}
+		if err := validateLocation(&location); err != nil {
+			return msg, err
+		}
+		payload, fallback = location, "Location"
+		if location.Name != "" {
+			fallback = "Location: " + location.Name
+		}
+
+	case MessageTypeContact:
+		var contact ContactPayload
+		if err := decodePayload(req.Payload, &contact); err != nil {
+			return msg, err
+		}
+		if err := validateContact(&contact); err != nil {
+			return msg, err
+		}
+		payload, fallback = contact, "Contact: "+contact.Name
+
+	case MessageTypePoll:
+		if req.GroupID == nil {
+			return msg, &ValidationError{"Polls can only be sent to groups"}
+		}
+		var poll PollPayload
+		if err := decodePayload(req.Payload, &poll); err != nil {
+			return msg, err
+		}
+		if err := validatePoll(&poll); err != nil {
+			return msg, err
+		}
+		payload, fallback = poll, "Poll: "+poll.Question
+
+	case MessageTypeSystem:
+		return msg, &ValidationError{"System messages can't be sent"}
+
+	default:
+		return msg, &ValidationError{"message_type must be one of text, markdown, location, contact or poll"}
+	}
+
+	normalized, err := json.Marshal(payload)
+	if err != nil {
+		return msg, err
+	}
+	msg.payload = normalized
+	if strings.TrimSpace(msg.content) == "" {
+		msg.content = fallback
+	}
+	return msg, nil
+}
+
+// decodePayload strictly decodes a payload, rejecting unknown fields
+func decodePayload(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return &ValidationError{"payload is required for this message type"}
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &ValidationError{fmt.Sprintf("payload is invalid: %v", err)}
+	}
+	if dec.More() {
+		return &ValidationError{"payload must be a single JSON object"}
+	}
+	return nil
+}
+
+// validateLocation checks coordinates and trims the optional labels
+func validateLocation(location *LocationPayload) error {
+	if location.Latitude == nil || location.Longitude == nil {
+		return &ValidationError{"latitude and longitude are required"}
+	}
+	if *location.Latitude < -90 || *location.Latitude > 90 {
+		return &ValidationError{"latitude must be between -90 and 90"}
+	}
+	if *location.Longitude < -180 || *location.Longitude > 180 {
+		return &ValidationError{"longitude must be between -180 and 180"}
+	}
+
+	location.Name = strings.TrimSpace(location.Name)
+	location.Address = strings.TrimSpace(location.Address)
+	if len(location.Name) > maxPlaceNameLength {
+		return &ValidationError{fmt.Sprintf("name must be at most %d characters", maxPlaceNameLength)}
+	}
+	if len(location.Address) > maxAddressLength {
+		return &ValidationError{fmt.Sprintf("address must be at most %d characters", maxAddressLength)}
+	}
+	return nil
+}
+
+// validateContact checks a contact card, normalizing its mobile number
+func validateContact(contact *ContactPayload) error {
+	contact.Name = strings.TrimSpace(contact.Name)
+	if contact.Name == "" || len(contact.Name) > maxContactNameLength {
+		return &ValidationError{fmt.Sprintf("name is required and must be at most %d characters", maxContactNameLength)}
+	}
+	if contact.MobileNo == "" && contact.Email == "" && contact.UserID == nil {
+		return &ValidationError{"A contact needs a mobile_no, email or user_id"}
+	}
+
+	if contact.MobileNo != "" {
+		normalized, err := normalizeMobileNo(contact.MobileNo)
+		if err != nil {
+			return err
+		}
+		contact.MobileNo = normalized
+	}
+	if contact.Email != "" {
+		if err := validateEmail(contact.Email); err != nil {
+			return err
+		}
+	}
+	if contact.UserID != nil && *contact.UserID <= 0 {
+		return &ValidationError{"user_id is invalid"}
+	}
+	return nil
+}
+
+// validatePoll checks a poll's question, options and close time
+func validatePoll(poll *PollPayload) error {
+	poll.Question = strings.TrimSpace(poll.Question)
+	if poll.Question == "" || len(poll.Question) > maxPollQuestionLength {
+		return &ValidationError{fmt.Sprintf("question is required and must be at most %d characters", maxPollQuestionLength)}
+	}
+
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return &ValidationError{fmt.Sprintf("A poll needs between %d and %d options", minPollOptions, maxPollOptions)}
+	}
+	seen := map[string]bool{}
+	for i, option := range poll.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || len(option) > maxPollOptionLength {
+			return &ValidationError{fmt.Sprintf("Options must be 1-%d characters", maxPollOptionLength)}
+		}
+		if seen[strings.ToLower(option)] {
+			return &ValidationError{"Options must be unique"}
+		}
+		seen[strings.ToLower(option)] = true
+		poll.Options[i] = option
+	}
+
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(time.Now()) {
+		return &ValidationError{"closes_at must be in the future"}
+	}
+	return nil
+}
+
+// nullableJSON stores an empty JSON document as NULL
+func nullableJSON(doc []byte) sql.NullString {
+	return sql.NullString{String: string(doc), Valid: len(doc) > 0}
+}
+
+// renderHints computes the rendering hints stored with a message. members maps the
+// usernames that can be mentioned to their IDs.
+func renderHints(messageType, content string, members map[string]int) []byte {
+	format := richtext.FormatPlain
+	if messageType == MessageTypeMarkdown {
+		format = richtext.FormatMarkdown
+	}
+	// Marshalling plain structs can't fail
+	hints, _ := json.Marshal(richtext.Analyze(content, format, members))
+	return hints
+}
+
+// resolveMentionsTx maps the usernames mentioned in content to members of the group
+func resolveMentionsTx(tx *sql.Tx, groupID int, content string) (map[string]int, error) {
+	usernames := richtext.MentionedUsernames(content)
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT u.id, u.username
+		FROM group_members gm
+		INNER JOIN users u ON u.id = gm.member_id
+		WHERE gm.group_id = $1 AND u.username = ANY($2)`
+	rows, err := tx.Query(query, groupID, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := map[string]int{}
+	for rows.Next() {
+		var id int
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		members[username] = id
+	}
+	return members, rows.Err()
+}
+
+// recordMentionsTx stores who a group message mentions, leaving out the sender
+func recordMentionsTx(tx *sql.Tx, messageID, senderID int, members map[string]int) error {
+	var userIDs []int64
+	for _, id := range members {
+		if id != senderID {
+			userIDs = append(userIDs, int64(id))
+		}
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO message_mentions (message_id, user_id)
+		SELECT $1, unnest($2::int[])
+		ON CONFLICT DO NOTHING`
+	_, err := tx.Exec(query, messageID, pq.Array(userIDs))
+	return err
+}
+
+// GetMentionsHandler lists group messages mentioning the current user, newest first.
+// Only groups the user is still a member of are included.
+func GetMentionsHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	limit := defaultMentionsLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxMentionsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxMentionsLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	args := []interface{}{int(userIDInt), limit}
+	cursor := ""
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		before, err := strconv.Atoi(beforeStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before must be a message ID"})
+			return
+		}
+		args = append(args, before)
+		cursor = `AND mm.message_id < $3`
+	}
+
+	query := `
+		SELECT ` + messageSelectColumns("$1") + `
+		FROM message_mentions mm
+		INNER JOIN messages m ON m.id = mm.message_id
+		INNER JOIN users u ON u.id = m.sender_id
+		WHERE mm.user_id = $1 AND ` + unexpiredMessageFilter + ` ` + cursor + `
+		  AND EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = m.group_id AND gm.member_id = $1)
+		ORDER BY mm.message_id DESC
+		LIMIT $2`
+
+	rows, err := db.GetDB().Query(query, args...)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve mentions"})
+		return
+	}
+	defer rows.Close()
+
+	messages := scanMessages(rows)
+	if messages == nil {
+		messages = []Message{}
+	}
+
+	response := gin.H{"mentions": messages}
+	if len(messages) == limit {
+		response["next_before"] = messages[len(messages)-1].ID
+	}
+
+	c.JSON(http.StatusOK, response)
+}
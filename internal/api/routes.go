@@ -1,6 +1,8 @@
 package api
 
 import (
+	"time"
+
 	"messaging-system/internal/middleware"
 
 	"github.com/gin-gonic/gin"
@@ -13,8 +15,11 @@ func SetupRoutes(router *gin.Engine) {
 	{
 		public.POST("/register", RegisterHandler)
 		public.POST("/login", LoginHandler)
+		public.POST("/login/2fa", TwoFactorLoginHandler)
 		public.POST("/logout", LogoutHandler)
 		public.POST("/refresh", RefreshTokenHandler)
+		public.POST("/password/forgot", ForgotPasswordHandler)
+		public.POST("/password/reset", ResetPasswordHandler)
 	}
 
 	// Protected routes
@@ -22,17 +27,125 @@ func SetupRoutes(router *gin.Engine) {
 	protected.Use(middleware.JWTAuthMiddleware())
 	{
 		protected.GET("/me", MeHandler)
+		protected.POST("/password/change", ChangePasswordHandler)
+
+		// Profile endpoints
+		protected.PATCH("/me/profile", UpdateProfileHandler)
+		protected.GET("/users/:id", GetUserProfileHandler)
+
+		// Push notification devices
+		protected.POST("/me/devices", RegisterDeviceHandler)
+		protected.GET("/me/devices", GetDevicesHandler)
+		protected.DELETE("/me/devices/:id", DeleteDeviceHandler)
+
+		// User discovery endpoints
+		protected.GET("/users/search",
+			middleware.RateLimit(getEnvInt("USER_SEARCH_RATE_LIMIT", 30), time.Minute),
+			SearchUsersHandler)
+		protected.POST("/users/contacts/match",
+			middleware.RateLimit(getEnvInt("CONTACT_MATCH_RATE_LIMIT", 10), time.Hour),
+			MatchContactsHandler)
+
+		// Blocking, contacts and privacy endpoints
+		protected.PUT("/me/privacy", UpdatePrivacyHandler)
+		protected.POST("/users/:id/block", BlockUserHandler)
+		protected.DELETE("/users/:id/block", UnblockUserHandler)
+		protected.GET("/blocks", GetBlockedUsersHandler)
+		protected.GET("/contacts", GetContactsHandler)
+		protected.POST("/contacts/:id", AddContactHandler)
+		protected.DELETE("/contacts/:id", RemoveContactHandler)
+
+		// Two-factor authentication endpoints
+		protected.POST("/2fa/enroll", EnrollTwoFactorHandler)
+		protected.POST("/2fa/confirm", ConfirmTwoFactorHandler)
+
+		// Phone verification endpoints
+		protected.POST("/phone/verify/request", RequestPhoneVerificationHandler)
+		protected.POST("/phone/verify/confirm", ConfirmPhoneVerificationHandler)
 
 		// Messaging endpoints
 		protected.POST("/message/send", SendMessageHandler)
 		protected.GET("/messages", GetMessagesHandler)
 		protected.GET("/conversation/:user_id", GetConversationHandler)
 		protected.GET("/group/:group_id/messages", GetGroupMessagesHandler)
+		protected.GET("/mentions", GetMentionsHandler)
+		protected.GET("/inbox", GetInboxHandler)
+
+		// Per-conversation mute, archive and notification settings
+		protected.GET("/conversation/:user_id/settings", GetConversationSettingsHandler)
+		protected.PATCH("/conversation/:user_id/settings", UpdateConversationSettingsHandler)
+		protected.GET("/group/:group_id/settings", GetConversationSettingsHandler)
+		protected.PATCH("/group/:group_id/settings", UpdateConversationSettingsHandler)
+
+		// Scheduled message endpoints
+		protected.GET("/scheduled-messages", GetScheduledMessagesHandler)
+		protected.PATCH("/scheduled-messages/:id", UpdateScheduledMessageHandler)
+		protected.DELETE("/scheduled-messages/:id", CancelScheduledMessageHandler)
+
+		// Pinned message endpoints
+		protected.POST("/messages/:message_id/pin", PinMessageHandler)
+		protected.DELETE("/messages/:message_id/pin", UnpinMessageHandler)
+		protected.GET("/group/:group_id/pins", GetGroupPinsHandler)
+		protected.GET("/conversation/:user_id/pins", GetConversationPinsHandler)
+
+		// Forwarding endpoint
+		protected.POST("/messages/:message_id/forward", ForwardMessageHandler)
+
+		// Poll endpoints (polls are sent as poll messages)
+		protected.GET("/messages/:message_id/poll", GetPollHandler)
+		protected.PUT("/messages/:message_id/poll/vote", VotePollHandler)
+		protected.DELETE("/messages/:message_id/poll/vote", RetractVoteHandler)
+		protected.POST("/messages/:message_id/poll/close", ClosePollHandler)
+
+		// Disappearing message timers
+		protected.PUT("/conversation/:user_id/timer", SetConversationTimerHandler)
+		protected.PUT("/group/:group_id/timer", SetGroupTimerHandler)
+
+		// Message request endpoints
+		protected.GET("/message-requests", GetMessageRequestsHandler)
+		protected.GET("/message-requests/:id/messages", GetMessageRequestMessagesHandler)
+		protected.POST("/message-requests/:id/accept", AcceptMessageRequestHandler)
+		protected.POST("/message-requests/:id/decline", DeclineMessageRequestHandler)
+		protected.POST("/message-requests/:id/block", BlockMessageRequestHandler)
 
 		// Group management endpoints
 		protected.POST("/group/create", CreateGroupHandler)
 		protected.POST("/group/:group_id/add-member", AddMemberToGroupHandler)
 		protected.GET("/groups", GetUserGroupsHandler)
 		protected.GET("/group/:group_id/members", GetGroupMembersHandler)
+		protected.PATCH("/group/:group_id", UpdateGroupHandler)
+		protected.DELETE("/group/:group_id/members/:member_id", RemoveGroupMemberHandler)
+		protected.PUT("/group/:group_id/members/:member_id/role", UpdateMemberRoleHandler)
+		protected.POST("/group/:group_id/transfer-ownership", TransferOwnershipHandler)
+		protected.DELETE("/group/:group_id", DeleteGroupHandler)
+		protected.GET("/group/:group_id/events", GetGroupEventsHandler)
+
+		// Group invite endpoints
+		protected.POST("/group/:group_id/invites", CreateGroupInviteHandler)
+		protected.GET("/group/:group_id/invites", GetGroupInvitesHandler)
+		protected.DELETE("/group/:group_id/invites/:invite_id", RevokeGroupInviteHandler)
+		protected.POST("/invites/join", JoinGroupByInviteHandler)
+
+		// Group join policy and join request endpoints
+		protected.PUT("/group/:group_id/join-policy", UpdateJoinPolicyHandler)
+		protected.POST("/group/:group_id/join", JoinGroupHandler)
+		protected.DELETE("/group/:group_id/join", CancelJoinRequestHandler)
+		protected.GET("/group/:group_id/join-requests", GetJoinRequestsHandler)
+		protected.POST("/group/:group_id/join-requests/:request_id/approve", ApproveJoinRequestHandler)
+		protected.POST("/group/:group_id/join-requests/:request_id/reject", RejectJoinRequestHandler)
+	}
+
+	// Server administration routes
+	admin := router.Group("/api/admin")
+	admin.Use(middleware.JWTAuthMiddleware(), middleware.AdminOnly())
+	{
+		// Retention policy and legal hold endpoints
+		admin.GET("/retention/policies", GetRetentionPoliciesHandler)
+		admin.PUT("/retention/policies", SetRetentionPolicyHandler)
+		admin.DELETE("/retention/policies/:id", DeleteRetentionPolicyHandler)
+		admin.GET("/retention/report", GetRetentionReportHandler)
+		admin.GET("/legal-holds", GetLegalHoldsHandler)
+		admin.POST("/legal-holds", CreateLegalHoldHandler)
+		admin.DELETE("/legal-holds/:id", ReleaseLegalHoldHandler)
 	}
 }
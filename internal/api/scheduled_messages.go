@@ -0,0 +1,464 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Scheduled message statuses
+const (
+	ScheduledPending   = "pending"
+	ScheduledSent      = "sent"
+	ScheduledCancelled = "cancelled"
+	ScheduledFailed    = "failed"
+)
+
+// scheduledDeliveryBatch is the most messages one scheduler tick delivers
+const scheduledDeliveryBatch = 100
+
+// ScheduledMessage is a message waiting to be delivered
+type ScheduledMessage struct {
+	ID          int             `json:"id"`
+	ReceiverID  *int            `json:"receiver_id,omitempty"`
+	GroupID     *int            `json:"group_id,omitempty"`
+	Content     string          `json:"content"`
+	MessageType string          `json:"message_type"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	SendAt      time.Time       `json:"send_at"`
+	Status      string          `json:"status"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// UpdateScheduledMessageRequest defines the structure for editing a pending scheduled message
+type UpdateScheduledMessageRequest struct {
+	Content *string    `json:"content,omitempty"`
+	SendAt  *time.Time `json:"send_at,omitempty"`
+}
+
+// validateSendAt checks a requested delivery time and returns it in local time.
+// Timestamps are stored without a zone and compared against time.Now(), so a send_at
+// given with another offset is converted first.
+func validateSendAt(sendAt time.Time) (time.Time, error) {
+	now := time.Now()
+	if !sendAt.After(now) {
+		return sendAt, &ValidationError{"send_at must be in the future"}
+	}
+	maxAhead := getEnvDuration("SCHEDULED_MESSAGE_MAX_AHEAD", 365*24*time.Hour)
+	if sendAt.After(now.Add(maxAhead)) {
+		return sendAt, &ValidationError{"send_at is too far in the future"}
+	}
+	return sendAt.Local(), nil
+}
+
+// scheduleMessage stores a message for later delivery. The send checks run now so
+// obvious mistakes fail fast, and again at delivery time.
+func scheduleMessage(c *gin.Context, senderID int, req SendMessageRequest, msg outgoingMessage) {
+	// A retry is answered before validation, its send_at may have passed by now
+	if msg.clientMessageID != "" && respondWithOriginalSchedule(c, senderID, req, msg) {
+		return
+	}
+
+	sendAt, err := validateSendAt(*req.SendAt)
+	if err == nil {
+		err = checkScheduledPoll(msg, sendAt)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.ReceiverID != nil {
+		err = checkDirectMessage(senderID, *req.ReceiverID)
+	} else {
+		err = checkGroupMessage(senderID, *req.GroupID)
+	}
+	if err != nil {
+		if status := sendErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule message"})
+		return
+	}
+
+	var scheduledID int
+	query := `INSERT INTO scheduled_messages (sender_id, receiver_id, group_id, content, message_type, payload, send_at, client_message_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (sender_id, client_message_id) WHERE client_message_id IS NOT NULL DO NOTHING
+		RETURNING id`
+	err = db.GetDB().QueryRow(query, senderID, req.ReceiverID, req.GroupID, msg.content, msg.messageType,
+		nullableJSON(msg.payload), sendAt, nullableClientMessageID(msg.clientMessageID)).Scan(&scheduledID)
+	// A concurrent retry stored the message first
+	if err == sql.ErrNoRows && respondWithOriginalSchedule(c, senderID, req, msg) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error scheduling message: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule message"})
+		return
+	}
+
+	response := gin.H{
+		"message":              "Message scheduled",
+		"scheduled_message_id": scheduledID,
+		"send_at":              sendAt,
+	}
+	if msg.clientMessageID != "" {
+		response["client_message_id"] = msg.clientMessageID
+	}
+	c.JSON(http.StatusAccepted, response)
+}
+
+// GetScheduledMessagesHandler lists the current user's pending scheduled messages, soonest first
+func GetScheduledMessagesHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	query := `
+		SELECT id, receiver_id, group_id, content, message_type, payload, send_at, status, created_at
+		FROM scheduled_messages
+		WHERE sender_id = $1 AND status = 'pending'
+		ORDER BY send_at, id`
+
+	rows, err := db.GetDB().Query(query, int(userIDInt))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scheduled messages"})
+		return
+	}
+	defer rows.Close()
+
+	scheduled := []ScheduledMessage{}
+	for rows.Next() {
+		var msg ScheduledMessage
+		err := rows.Scan(&msg.ID, &msg.ReceiverID, &msg.GroupID, &msg.Content, &msg.MessageType,
+			(*[]byte)(&msg.Payload), &msg.SendAt, &msg.Status, &msg.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning scheduled message: %v", err)
+			continue
+		}
+		scheduled = append(scheduled, msg)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled_messages": scheduled})
+}
+
+// lockPendingScheduledTx locks one of the user's scheduled messages and checks it hasn't
+// been delivered or cancelled yet. It writes the error response and returns false otherwise.
+func lockPendingScheduledTx(c *gin.Context, tx *sql.Tx, scheduledID, userID int, action string) bool {
+	var status string
+	query := `SELECT status FROM scheduled_messages WHERE id = $1 AND sender_id = $2 FOR UPDATE`
+	if err := tx.QueryRow(query, scheduledID, userID).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled message not found"})
+			return false
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + " scheduled message"})
+		return false
+	}
+	if status != ScheduledPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Scheduled message is already " + status})
+		return false
+	}
+	return true
+}
+
+// UpdateScheduledMessageHandler edits the content or delivery time of a pending scheduled message
+func UpdateScheduledMessageHandler(c *gin.Context) {
+	var req UpdateScheduledMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Content == nil && req.SendAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	if req.Content != nil && *req.Content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content cannot be empty"})
+		return
+	}
+
+	var sendAt sql.NullTime
+	if req.SendAt != nil {
+		validated, err := validateSendAt(*req.SendAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sendAt = sql.NullTime{Time: validated, Valid: true}
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	scheduledID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled message ID"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled message"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Waits for the scheduler if it is delivering this message right now
+	if !lockPendingScheduledTx(c, tx, scheduledID, int(userIDInt), "update") {
+		return
+	}
+
+	// A poll moved to a later send_at must still be open when it is delivered
+	if sendAt.Valid {
+		var msg outgoingMessage
+		query := `SELECT message_type, payload FROM scheduled_messages WHERE id = $1`
+		if err := tx.QueryRow(query, scheduledID).Scan(&msg.messageType, &msg.payload); err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled message"})
+			return
+		}
+		if err := checkScheduledPoll(msg, sendAt.Time); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var msg ScheduledMessage
+	query := `UPDATE scheduled_messages
+		SET content = COALESCE($1, content), send_at = COALESCE($2, send_at), updated_at = NOW()
+		WHERE id = $3
+		RETURNING id, receiver_id, group_id, content, message_type, payload, send_at, status, created_at`
+	err = tx.QueryRow(query, req.Content, sendAt, scheduledID).
+		Scan(&msg.ID, &msg.ReceiverID, &msg.GroupID, &msg.Content, &msg.MessageType,
+			(*[]byte)(&msg.Payload), &msg.SendAt, &msg.Status, &msg.CreatedAt)
+	if err != nil {
+		log.Printf("Error updating scheduled message: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled message"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled_message": msg})
+}
+
+// CancelScheduledMessageHandler cancels a pending scheduled message
+func CancelScheduledMessageHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	scheduledID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled message ID"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel scheduled message"})
+		return
+	}
+	defer tx.Rollback()
+
+	if !lockPendingScheduledTx(c, tx, scheduledID, int(userIDInt), "cancel") {
+		return
+	}
+
+	query := `UPDATE scheduled_messages SET status = 'cancelled', updated_at = NOW() WHERE id = $1`
+	if _, err := tx.Exec(query, scheduledID); err != nil {
+		log.Printf("Error cancelling scheduled message: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel scheduled message"})
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel scheduled message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scheduled message cancelled"})
+}
+
+// StartMessageScheduler starts the background worker that delivers due scheduled messages.
+// Every replica can run it: rows are claimed with FOR UPDATE SKIP LOCKED and marked sent in
+// the same transaction that inserts the message, so each one is delivered exactly once.
+func StartMessageScheduler() {
+	interval := getEnvDuration("MESSAGE_SCHEDULER_INTERVAL", 10*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			deliverDueMessages()
+		}
+	}()
+	log.Printf("Message scheduler started (every %s)", interval)
+}
+
+// deliverDueMessages delivers up to scheduledDeliveryBatch due messages. A message that
+// hits a database error stays pending for the next tick and is skipped for the rest of
+// this one, so it can't hold up the messages due after it.
+func deliverDueMessages() {
+	skipped := []int64{}
+	for i := 0; i < scheduledDeliveryBatch; i++ {
+		scheduledID, err := deliverNextScheduledMessage(skipped)
+		if err != nil {
+			log.Printf("Error delivering scheduled message: %v", err)
+			if scheduledID == 0 {
+				// Nothing could be claimed, try again on the next tick
+				return
+			}
+			skipped = append(skipped, int64(scheduledID))
+			continue
+		}
+		if scheduledID == 0 {
+			return
+		}
+	}
+}
+
+// deliverNextScheduledMessage claims and delivers one due message that isn't in skipped,
+// returning its ID, or 0 when nothing is due. Messages the sender may no longer send, and
+// messages whose insert fails for good, are marked failed.
+func deliverNextScheduledMessage(skipped []int64) (int, error) {
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var scheduledID, senderID int
+	var receiverID, groupID sql.NullInt64
+	var msg outgoingMessage
+	query := `SELECT id, sender_id, receiver_id, group_id, content, message_type, payload
+		FROM scheduled_messages
+		WHERE status = 'pending' AND send_at <= $1 AND id <> ALL($2::integer[])
+		ORDER BY send_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`
+	err = tx.QueryRow(query, time.Now(), pq.Array(skipped)).
+		Scan(&scheduledID, &senderID, &receiverID, &groupID, &msg.content, &msg.messageType, &msg.payload)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Same checks as sending right now: the sender may have been blocked or left the group
+	if receiverID.Valid {
+		err = checkDirectMessage(senderID, int(receiverID.Int64))
+	} else {
+		err = checkGroupMessage(senderID, int(groupID.Int64))
+	}
+	if err != nil {
+		if sendErrorStatus(err) == http.StatusInternalServerError {
+			return scheduledID, err
+		}
+		query = `UPDATE scheduled_messages SET status = 'failed', failure_reason = $1, updated_at = NOW() WHERE id = $2`
+		if _, err := tx.Exec(query, err.Error(), scheduledID); err != nil {
+			return scheduledID, err
+		}
+		return scheduledID, tx.Commit()
+	}
+
+	var sent SentMessage
+	if receiverID.Valid {
+		sent, err = insertDirectMessageTx(tx, senderID, int(receiverID.Int64), msg)
+	} else {
+		sent, err = insertGroupMessageTx(tx, senderID, int(groupID.Int64), msg)
+	}
+	if err == nil {
+		query = `UPDATE scheduled_messages SET status = 'sent', message_id = $1, updated_at = NOW() WHERE id = $2`
+		_, err = tx.Exec(query, sent.ID, scheduledID)
+	}
+	if err != nil {
+		tx.Rollback()
+		if !permanentDeliveryError(err) {
+			// Stays pending and is retried on the next tick
+			return scheduledID, err
+		}
+		return scheduledID, failScheduledMessage(scheduledID, err)
+	}
+
+	// Commit transaction
+	return scheduledID, tx.Commit()
+}
+
+// permanentDeliveryError reports whether delivering a scheduled message failed in a way
+// retrying can't fix: a payload that no longer decodes, or data or constraint errors from
+// the database. Connection drops, deadlocks and serialization failures are worth a retry.
+func permanentDeliveryError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		class := pqErr.Code.Class()
+		return class == "22" || class == "23"
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+// failScheduledMessage marks a pending scheduled message failed after its delivery hit an error
+func failScheduledMessage(scheduledID int, cause error) error {
+	log.Printf("Error delivering scheduled message %d, marking it failed: %v", scheduledID, cause)
+	query := `UPDATE scheduled_messages SET status = 'failed', failure_reason = 'Delivery failed', updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'`
+	_, err := db.GetDB().Exec(query, scheduledID)
+	return err
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestPermanentDeliveryError(t *testing.T) {
+	var syntaxErr *json.SyntaxError
+	badPayload := json.Unmarshal([]byte(`{"question":`), &PollPayload{})
+	if !errors.As(badPayload, &syntaxErr) {
+		t.Fatalf("test payload error is %T, want *json.SyntaxError", badPayload)
+	}
+	wrongType := json.Unmarshal([]byte(`{"question": 5}`), &PollPayload{})
+
+	tests := []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, true},
+		{"foreign key violation", &pq.Error{Code: "23503"}, true},
+		{"check violation", &pq.Error{Code: "23514"}, true},
+		{"invalid text representation", &pq.Error{Code: "22P02"}, true},
+		{"value too long", &pq.Error{Code: "22001"}, true},
+		{"wrapped constraint error", fmt.Errorf("inserting poll: %w", &pq.Error{Code: "23505"}), true},
+		{"payload doesn't decode", badPayload, true},
+		{"payload has the wrong type", wrongType, true},
+		{"serialization failure", &pq.Error{Code: "40001"}, false},
+		{"deadlock", &pq.Error{Code: "40P01"}, false},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, false},
+		{"too many connections", &pq.Error{Code: "53300"}, false},
+		{"bad connection", driver.ErrBadConn, false},
+		{"connection reset", io.ErrUnexpectedEOF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := permanentDeliveryError(tt.err); got != tt.permanent {
+				t.Errorf("permanentDeliveryError(%v) = %v, want %v", tt.err, got, tt.permanent)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"messaging-system/internal/auth"
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// recoveryCodeCount is the number of recovery codes issued when 2FA is confirmed
+const recoveryCodeCount = 10
+
+// maxChallengeAttempts is the number of wrong codes allowed per login challenge
+const maxChallengeAttempts = 5
+
+// ConfirmTwoFactorRequest defines the structure for confirming 2FA enrollment
+type ConfirmTwoFactorRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginRequest defines the structure for completing a two-step login
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code,omitempty"`
+	RecoveryCode   string `json:"recovery_code,omitempty"`
+}
+
+// challengeAttempts tracks failed codes per challenge token jti
+var (
+	challengeAttempts      = make(map[string]challengeAttempt)
+	challengeAttemptsMutex sync.Mutex
+)
+
+type challengeAttempt struct {
+	count  int
+	expiry time.Time
+}
+
+// recordFailedChallenge counts a failed attempt and reports whether the challenge is now exhausted
+func recordFailedChallenge(jti string, expiry time.Time) bool {
+	challengeAttemptsMutex.Lock()
+	defer challengeAttemptsMutex.Unlock()
+
+	// Drop entries for challenges that have expired anyway
+	now := time.Now()
+	for id, attempt := range challengeAttempts {
+		if now.After(attempt.expiry) {
+			delete(challengeAttempts, id)
+		}
+	}
+
+	attempt := challengeAttempts[jti]
+	attempt.count++
+	attempt.expiry = expiry
+	challengeAttempts[jti] = attempt
+
+	if attempt.count >= maxChallengeAttempts {
+		delete(challengeAttempts, jti)
+		return true
+	}
+	return false
+}
+
+// clearChallengeAttempts forgets the failure count for a challenge
+func clearChallengeAttempts(jti string) {
+	challengeAttemptsMutex.Lock()
+	defer challengeAttemptsMutex.Unlock()
+
+	delete(challengeAttempts, jti)
+}
+
+// generateTwoFactorChallenge issues the short-lived token returned by LoginHandler
+// when the user still has to provide a second factor
+func generateTwoFactorChallenge(userID int, username string) (string, error) {
+	challengeDuration := getEnvDuration("TWO_FACTOR_CHALLENGE_DURATION", 5*time.Minute)
+
+	claims := jwt.MapClaims{
+		"user_id":  userID,
+		"username": username,
+		"iat":      time.Now().Unix(),
+		"exp":      time.Now().Add(challengeDuration).Unix(),
+		"type":     "2fa_challenge",
+		"jti":      generateTokenID(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// EnrollTwoFactorHandler generates a new TOTP secret for the current user
+func EnrollTwoFactorHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	// Fetch the account name and current 2FA state
+	var username string
+	var enabled bool
+	query := `SELECT username, totp_enabled FROM users WHERE id = $1`
+	err := db.GetDB().QueryRow(query, int(userIDInt)).Scan(&username, &enabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	// Store the pending secret; it only takes effect once confirmed with a code
+	query = `UPDATE users SET totp_secret = $1, totp_last_step = NULL WHERE id = $2 AND totp_enabled = false`
+	_, err = db.GetDB().Exec(query, secret, int(userIDInt))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Messaging System"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Scan the otpauth URI with an authenticator app and confirm with a code",
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPProvisioningURI(issuer, username, secret),
+	})
+}
+
+// ConfirmTwoFactorHandler enables 2FA after the user proves they can generate codes
+func ConfirmTwoFactorHandler(c *gin.Context) {
+	var req ConfirmTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var secret sql.NullString
+	var enabled bool
+	query := `SELECT totp_secret, totp_enabled FROM users WHERE id = $1`
+	err := db.GetDB().QueryRow(query, int(userIDInt)).Scan(&secret, &enabled)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm two-factor authentication"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if !secret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor enrollment has not been started"})
+		return
+	}
+
+	step, valid := auth.ValidateTOTPCode(secret.String, req.Code, time.Now())
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	recoveryCodes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm two-factor authentication"})
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.GetDB().Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm two-factor authentication"})
+		return
+	}
+	defer tx.Rollback()
+
+	query = `UPDATE users SET totp_enabled = true, totp_last_step = $1 WHERE id = $2`
+	_, err = tx.Exec(query, step, int(userIDInt))
+	if err != nil {
+		log.Printf("Error enabling 2FA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm two-factor authentication"})
+		return
+	}
+
+	// Replace any recovery codes left over from a previous enrollment
+	query = `DELETE FROM user_recovery_codes WHERE user_id = $1`
+	_, err = tx.Exec(query, int(userIDInt))
+	if err != nil {
+		log.Printf("Error clearing recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm two-factor authentication"})
+		return
+	}
+
+	query = `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(query, int(userIDInt), auth.HashRecoveryCode(code))
+		if err != nil {
+			log.Printf("Error storing recovery code: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm two-factor authentication"})
+			return
+		}
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// TwoFactorLoginHandler completes a login that was paused for a second factor
+func TwoFactorLoginHandler(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Exactly one of code or recovery_code must be provided
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either code or recovery_code must be provided, but not both"})
+		return
+	}
+
+	// Parse and validate the challenge token
+	token, err := jwt.Parse(req.ChallengeToken, func(token *jwt.Token) (interface{}, error) {
+		// Validate the signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge token"})
+		return
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid challenge token"})
+		return
+	}
+
+	tokenType, ok := claims["type"].(string)
+	if !ok || tokenType != "2fa_challenge" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token type"})
+		return
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token: missing jti claim"})
+		return
+	}
+	if auth.GetTokenBlacklist().IsBlacklisted(jti) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Challenge token has already been used"})
+		return
+	}
+
+	// A password change since the challenge was issued invalidates it
+	revoked, err := isSessionRevoked(claims)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process login"})
+		return
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Challenge token has been revoked"})
+		return
+	}
+
+	var expiryTime time.Time
+	if exp, ok := claims["exp"].(float64); ok {
+		expiryTime = time.Unix(int64(exp), 0)
+	} else {
+		expiryTime = time.Now().Add(24 * time.Hour)
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+
+	// Load the user's 2FA state
+	var user struct {
+		Username string
+		Secret   sql.NullString
+		Enabled  bool
+	}
+	query := `SELECT username, totp_secret, totp_enabled FROM users WHERE id = $1`
+	err = db.GetDB().QueryRow(query, int(userID)).Scan(&user.Username, &user.Secret, &user.Enabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		}
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process login"})
+		return
+	}
+	if !user.Enabled || !user.Secret.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	var verified bool
+	if req.Code != "" {
+		if step, valid := auth.ValidateTOTPCode(user.Secret.String, req.Code, time.Now()); valid {
+			// Only accept a time step newer than the last one used, so a code cannot be replayed
+			query = `UPDATE users SET totp_last_step = $1
+				WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+			result, err := db.GetDB().Exec(query, step, int(userID))
+			if err != nil {
+				log.Printf("Database error: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process login"})
+				return
+			}
+			rows, _ := result.RowsAffected()
+			verified = rows == 1
+		}
+	} else {
+		// Recovery codes are consumed by the same statement that checks them
+		query = `UPDATE user_recovery_codes SET used_at = NOW()
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+		result, err := db.GetDB().Exec(query, int(userID), auth.HashRecoveryCode(req.RecoveryCode))
+		if err != nil {
+			log.Printf("Database error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process login"})
+			return
+		}
+		rows, _ := result.RowsAffected()
+		verified = rows == 1
+	}
+
+	if !verified {
+		if recordFailedChallenge(jti, expiryTime) {
+			auth.GetTokenBlacklist().Add(jti, expiryTime)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many invalid codes, please log in again"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	// The challenge is single use
+	clearChallengeAttempts(jti)
+	auth.GetTokenBlacklist().Add(jti, expiryTime)
+
+	accessTokenString, refreshTokenString, err := generateTokenPair(int(userID), user.Username)
+	if err != nil {
+		log.Printf("Error generating tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Login successful",
+		"access_token":  accessTokenString,
+		"refresh_token": refreshTokenString,
+	})
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"messaging-system/pkg/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Search limits
+const (
+	minSearchPrefixLength = 2
+	defaultSearchLimit    = 20
+	maxSearchLimit        = 50
+)
+
+// sha256HexPattern matches a lower-case hex SHA-256 digest
+var sha256HexPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// likeEscaper escapes LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ContactMatchRequest defines the structure for matching hashed phone numbers
+type ContactMatchRequest struct {
+	Hashes []string `json:"hashes" binding:"required"`
+}
+
+// ContactMatch pairs a submitted hash with the user it belongs to
+type ContactMatch struct {
+	Hash string      `json:"hash"`
+	User UserSummary `json:"user"`
+}
+
+// SearchUsersHandler finds users by username/display-name prefix or exact mobile number
+func SearchUsersHandler(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	prefix := strings.TrimSpace(c.Query("q"))
+	mobileNo := c.Query("mobile_no")
+
+	if (prefix == "") == (mobileNo == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either q or mobile_no must be provided, but not both"})
+		return
+	}
+
+	var query string
+	var args []interface{}
+	if mobileNo != "" {
+		// Exact lookup only; unverified numbers are not discoverable
+		normalized, err := normalizeMobileNo(mobileNo)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query = `
+			SELECT id, username, display_name, avatar_url
+			FROM users
+			WHERE mobile_no = $1 AND mobile_verified = true AND id <> $2
+			  AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = users.id AND b.blocked_id = $2)`
+		args = []interface{}{normalized, int(userIDInt)}
+	} else {
+		if utf8.RuneCountInString(prefix) < minSearchPrefixLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("q must be at least %d characters", minSearchPrefixLength)})
+			return
+		}
+		pattern := likeEscaper.Replace(strings.ToLower(prefix)) + "%"
+		query = `
+			SELECT id, username, display_name, avatar_url
+			FROM users
+			WHERE (lower(username) LIKE $1 OR lower(display_name) LIKE $1) AND id <> $2
+			  AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = users.id AND b.blocked_id = $2)
+			ORDER BY lower(username) = $3 DESC, username ASC
+			LIMIT $4`
+		args = []interface{}{pattern, int(userIDInt), strings.ToLower(prefix), limit}
+	}
+
+	rows, err := db.GetDB().Query(query, args...)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+	defer rows.Close()
+
+	users := []UserSummary{}
+	for rows.Next() {
+		var user UserSummary
+		if err := rows.Scan(&user.ID, &user.Username, &user.DisplayName, &user.AvatarURL); err != nil {
+			log.Printf("Error scanning user: %v", err)
+			continue
+		}
+		users = append(users, user)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// MatchContactsHandler returns the users whose verified mobile numbers match a batch of
+// SHA-256 hashes, so clients can build a contact list without seeing other users' numbers
+func MatchContactsHandler(c *gin.Context) {
+	var req ContactMatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user ID from context
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userIDInt, ok := userID.(float64)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	maxHashes := getEnvInt("CONTACT_MATCH_MAX_HASHES", 500)
+	if len(req.Hashes) == 0 || len(req.Hashes) > maxHashes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("hashes must contain between 1 and %d entries", maxHashes)})
+		return
+	}
+
+	hashes := make([]string, 0, len(req.Hashes))
+	for _, hash := range req.Hashes {
+		hash = strings.ToLower(strings.TrimSpace(hash))
+		if !sha256HexPattern.MatchString(hash) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Each hash must be a hex SHA-256 of an E.164 mobile number"})
+			return
+		}
+		hashes = append(hashes, hash)
+	}
+
+	query := `
+		SELECT mobile_hash, id, username, display_name, avatar_url
+		FROM users
+		WHERE mobile_hash = ANY($1) AND mobile_verified = true AND id <> $2
+		  AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = users.id AND b.blocked_id = $2)`
+
+	rows, err := db.GetDB().Query(query, pq.Array(hashes), int(userIDInt))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to match contacts"})
+		return
+	}
+	defer rows.Close()
+
+	matches := []ContactMatch{}
+	for rows.Next() {
+		var match ContactMatch
+		err := rows.Scan(&match.Hash, &match.User.ID, &match.User.Username, &match.User.DisplayName, &match.User.AvatarURL)
+		if err != nil {
+			log.Printf("Error scanning contact match: %v", err)
+			continue
+		}
+		matches = append(matches, match)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"matches": matches})
+}
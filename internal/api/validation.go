@@ -0,0 +1,65 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// usernamePattern allows 3-30 letters, digits, underscores and dots, starting with a letter
+	usernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.]{2,29}$`)
+	// e164Pattern matches an E.164 phone number: "+", country code, up to 15 digits in total
+	e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	// phoneSeparators are stripped before validating a mobile number
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+)
+
+// validateUsername checks the username format rules
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return &ValidationError{"Username must be 3-30 characters, start with a letter and contain only letters, digits, '_' or '.'"}
+	}
+	if strings.Contains(username, "..") {
+		return &ValidationError{"Username must not contain consecutive dots"}
+	}
+	return nil
+}
+
+// normalizeMobileNo strips common separators and validates the result as E.164
+func normalizeMobileNo(mobileNo string) (string, error) {
+	normalized := phoneSeparators.Replace(strings.TrimSpace(mobileNo))
+	if !e164Pattern.MatchString(normalized) {
+		return "", &ValidationError{"Mobile number must be in E.164 format, e.g. +14155552671"}
+	}
+	return normalized, nil
+}
+
+// hashMobileNo returns the hex SHA-256 of a normalized mobile number, as used for contact matching
+func hashMobileNo(mobileNo string) string {
+	sum := sha256.Sum256([]byte(mobileNo))
+	return hex.EncodeToString(sum[:])
+}
+
+// validateEmail checks that an email is a bare address (no display name)
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > 255 {
+		return &ValidationError{"Email address is invalid"}
+	}
+	return nil
+}
+
+// uniqueViolation reports the constraint name when err is a Postgres unique-violation
+func uniqueViolation(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return pqErr.Constraint, true
+	}
+	return "", false
+}
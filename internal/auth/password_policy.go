@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// sha1LinePattern matches SHA-1 hashes as published in breached password lists,
+// optionally followed by an occurrence count ("HASH:count")
+var sha1LinePattern = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+
+// PasswordPolicyError describes why a password was rejected
+type PasswordPolicyError struct {
+	Message string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Message
+}
+
+// PasswordPolicy holds the rules applied to new passwords
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+
+	blockedPlain map[string]struct{} // Lower-cased plaintext passwords
+	blockedSHA1  map[string]struct{} // Upper-case hex SHA-1 of breached passwords
+}
+
+// NewPasswordPolicy creates a policy with the built-in common-password list
+func NewPasswordPolicy(minLength, maxLength int) *PasswordPolicy {
+	p := &PasswordPolicy{
+		MinLength:    minLength,
+		MaxLength:    maxLength,
+		blockedPlain: make(map[string]struct{}),
+		blockedSHA1:  make(map[string]struct{}),
+	}
+	p.loadBlocklist(strings.NewReader(commonPasswords))
+	return p
+}
+
+// LoadBlocklistFile adds an offline breached/common password list to the policy.
+// Each line is either a plaintext password or a SHA-1 hash ("HASH" or "HASH:count").
+func (p *PasswordPolicy) LoadBlocklistFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return p.loadBlocklist(file)
+}
+
+// loadBlocklist reads blocklist entries, skipping blank lines and # comments
+func (p *PasswordPolicy) loadBlocklist(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if sha1LinePattern.MatchString(line) {
+			hash, _, _ := strings.Cut(line, ":")
+			p.blockedSHA1[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		p.blockedPlain[strings.ToLower(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// Validate checks a password against the policy
+func (p *PasswordPolicy) Validate(password, username string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return &PasswordPolicyError{fmt.Sprintf("Password must be at least %d characters long", p.MinLength)}
+	}
+	// bcrypt only uses the first 72 bytes, so longer passwords are rejected rather than truncated
+	if len(password) > p.MaxLength {
+		return &PasswordPolicyError{fmt.Sprintf("Password must be at most %d bytes long", p.MaxLength)}
+	}
+
+	if username != "" && strings.EqualFold(password, username) {
+		return &PasswordPolicyError{"Password must not be the same as the username"}
+	}
+
+	if _, blocked := p.blockedPlain[strings.ToLower(password)]; blocked {
+		return &PasswordPolicyError{"Password is too common, please choose another one"}
+	}
+
+	sum := sha1.Sum([]byte(password))
+	if _, blocked := p.blockedSHA1[strings.ToUpper(hex.EncodeToString(sum[:]))]; blocked {
+		return &PasswordPolicyError{"Password has appeared in a data breach, please choose another one"}
+	}
+
+	return nil
+}
+
+// Global password policy instance
+var (
+	globalPasswordPolicy     *PasswordPolicy
+	globalPasswordPolicyOnce sync.Once
+)
+
+// GetPasswordPolicy returns the password policy configured through
+// PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH and PASSWORD_BLOCKLIST_FILE
+func GetPasswordPolicy() *PasswordPolicy {
+	globalPasswordPolicyOnce.Do(func() {
+		minLength := getEnvInt("PASSWORD_MIN_LENGTH", 8)
+		maxLength := getEnvInt("PASSWORD_MAX_LENGTH", 72)
+		if maxLength > 72 {
+			maxLength = 72
+		}
+
+		globalPasswordPolicy = NewPasswordPolicy(minLength, maxLength)
+
+		if path := os.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+			if err := globalPasswordPolicy.LoadBlocklistFile(path); err != nil {
+				log.Printf("Failed to load password blocklist %s: %v", path, err)
+			}
+		}
+	})
+	return globalPasswordPolicy
+}
+
+// getEnvInt returns the integer from an environment variable or the default value
+func getEnvInt(key string, defaultValue int) int {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		log.Printf("Failed to parse integer from %s=%s, using default", key, valueStr)
+		return defaultValue
+	}
+	return value
+}
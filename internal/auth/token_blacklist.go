@@ -7,15 +7,23 @@ import (
 
 // TokenBlacklist manages a list of invalidated tokens
 type TokenBlacklist struct {
-	blacklist     map[string]time.Time // Maps token string to expiration time
+	blacklist     map[string]time.Time   // Maps token string to expiration time
+	userRevoked   map[int]userRevocation // Maps user ID to a cut-off for all their tokens
 	mutex         sync.RWMutex
 	cleanupTicker *time.Ticker
 }
 
+// userRevocation invalidates every token of a user issued before a point in time
+type userRevocation struct {
+	before time.Time // Tokens issued before this time are revoked
+	expiry time.Time // When the entry can be dropped (no older token can still be valid)
+}
+
 // NewTokenBlacklist creates a new token blacklist with automatic cleanup
 func NewTokenBlacklist(cleanupInterval time.Duration) *TokenBlacklist {
 	tb := &TokenBlacklist{
 		blacklist:     make(map[string]time.Time),
+		userRevoked:   make(map[int]userRevocation),
 		cleanupTicker: time.NewTicker(cleanupInterval),
 	}
 
@@ -57,6 +65,29 @@ func (tb *TokenBlacklist) IsBlacklisted(token string) bool {
 	return true
 }
 
+// RevokeUserTokens invalidates all tokens of a user issued before the given time.
+// The entry is kept until expiry, which should be the longest token lifetime from now.
+func (tb *TokenBlacklist) RevokeUserTokens(userID int, before time.Time, expiry time.Time) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	tb.userRevoked[userID] = userRevocation{before: before, expiry: expiry}
+}
+
+// IsUserTokenRevoked checks if a token issued at issuedAt was revoked by RevokeUserTokens.
+// Token issue times only have second precision, so the cut-off is compared in seconds.
+func (tb *TokenBlacklist) IsUserTokenRevoked(userID int, issuedAt time.Time) bool {
+	tb.mutex.RLock()
+	defer tb.mutex.RUnlock()
+
+	revocation, exists := tb.userRevoked[userID]
+	if !exists {
+		return false
+	}
+
+	return issuedAt.Unix() < revocation.before.Unix()
+}
+
 // cleanup removes expired tokens from the blacklist
 func (tb *TokenBlacklist) cleanup() {
 	tb.mutex.Lock()
@@ -68,6 +99,11 @@ func (tb *TokenBlacklist) cleanup() {
 			delete(tb.blacklist, token)
 		}
 	}
+	for userID, revocation := range tb.userRevoked {
+		if now.After(revocation.expiry) {
+			delete(tb.userRevoked, userID)
+		}
+	}
 }
 
 // periodicCleanup runs the cleanup function at regular intervals
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// TOTPPeriod is the length of a single TOTP time step (RFC 6238 default)
+	TOTPPeriod = 30 * time.Second
+	// TOTPDigits is the number of digits in a generated code
+	TOTPDigits = 6
+	// totpSkew is the number of time steps accepted on either side of the current one
+	totpSkew = 1
+)
+
+// base32NoPadding is the encoding used by authenticator apps for shared secrets
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret creates a new random base32 encoded shared secret
+func GenerateTOTPSecret() (string, error) {
+	// 20 bytes matches the HMAC-SHA1 block recommendation of RFC 4226
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(b), nil
+}
+
+// TOTPProvisioningURI builds the otpauth:// URI that authenticator apps scan
+func TOTPProvisioningURI(issuer, accountName, secret string) string {
+	label := url.PathEscape(issuer + ":" + accountName)
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", TOTPDigits))
+	params.Set("period", fmt.Sprintf("%d", int(TOTPPeriod/time.Second)))
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// TOTPStep returns the time step counter for the given time
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// GenerateTOTPCode computes the code for a secret at a specific time step
+func GenerateTOTPCode(secret string, step int64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation as described in RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+// ValidateTOTPCode checks a code against the secret allowing for clock skew.
+// It returns the matched time step so callers can reject reuse of the same code.
+func ValidateTOTPCode(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	current := TOTPStep(t)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := current + int64(i)
+		expected, err := GenerateTOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes creates a set of single-use recovery codes in the form xxxxx-xxxxx
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(b)
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the value stored in the database for a recovery code.
+// Codes are normalized so users can type them with or without the dash.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminOnly restricts a route to the server administrators listed in ADMIN_USER_IDS
+// (comma separated user IDs). With no list configured every request is refused.
+// It must run after JWTAuthMiddleware.
+func AdminOnly() gin.HandlerFunc {
+	admins := make(map[int]bool)
+	for _, field := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			log.Printf("Ignoring invalid ADMIN_USER_IDS entry %q", field)
+			continue
+		}
+		admins[id] = true
+	}
+
+	return func(c *gin.Context) {
+		userID, _ := c.Get("user_id")
+		userIDFloat, ok := userID.(float64)
+		if !ok || !admins[int(userIDFloat)] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Administrator access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
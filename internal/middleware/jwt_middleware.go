@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"messaging-system/internal/auth"
 
@@ -87,6 +88,17 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 				return
 			}
 
+			// Check if all of the user's sessions were revoked (e.g. after a password change)
+			var issuedAt time.Time
+			if iat, ok := claims["iat"].(float64); ok {
+				issuedAt = time.Unix(int64(iat), 0)
+			}
+			if uid, ok := userId.(float64); ok && auth.GetTokenBlacklist().IsUserTokenRevoked(int(uid), issuedAt) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				c.Abort()
+				return
+			}
+
 			// Set the user ID in the context
 			c.Set("user_id", userId)
 
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateWindow counts requests from one client in the current window
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// RateLimiter is a fixed-window request counter keyed by client
+type RateLimiter struct {
+	limit   int
+	window  time.Duration
+	clients map[string]*rateWindow
+	mutex   sync.Mutex
+}
+
+// NewRateLimiter creates a limiter allowing limit requests per window per client
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		clients: make(map[string]*rateWindow),
+	}
+}
+
+// Allow records a request for key and reports whether it is within the limit,
+// along with the time until the current window resets
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := time.Now()
+
+	// Drop finished windows once the map grows, so idle clients don't accumulate
+	if len(rl.clients) > 10000 {
+		for k, w := range rl.clients {
+			if now.Sub(w.start) >= rl.window {
+				delete(rl.clients, k)
+			}
+		}
+	}
+
+	w, exists := rl.clients[key]
+	if !exists || now.Sub(w.start) >= rl.window {
+		w = &rateWindow{start: now}
+		rl.clients[key] = w
+	}
+
+	retryAfter := w.start.Add(rl.window).Sub(now)
+	if w.count >= rl.limit {
+		return false, retryAfter
+	}
+	w.count++
+	return true, retryAfter
+}
+
+// RateLimit limits requests per authenticated user (or client IP when there is no user)
+func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	limiter := NewRateLimiter(limit, window)
+
+	return func(c *gin.Context) {
+		key := c.ClientIP()
+		if userID, exists := c.Get("user_id"); exists {
+			key = fmt.Sprintf("user:%v", userID)
+		}
+
+		allowed, retryAfter := limiter.Allow(key)
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded, please try again later"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
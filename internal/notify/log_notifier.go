@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogNotifier writes notifications to a log file (or stderr) instead of delivering them.
+// It is meant for local development where no mail server is available.
+type LogNotifier struct {
+	mutex  sync.Mutex
+	logger *log.Logger
+}
+
+// NewLogNotifier creates a notifier that appends to path, or logs to stderr when path is empty
+func NewLogNotifier(path string) (*LogNotifier, error) {
+	var out io.Writer = os.Stderr
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+
+	return &LogNotifier{logger: log.New(out, "[notify] ", log.LstdFlags)}, nil
+}
+
+// Notify records the message
+func (n *LogNotifier) Notify(ctx context.Context, msg Message) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.logger.Print(fmt.Sprintf("to=%s (user %d, email %q) at=%s subject=%q\n%s",
+		msg.To.Username, msg.To.UserID, msg.To.Email, time.Now().Format(time.RFC3339), msg.Subject, msg.Body))
+	return nil
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrNoAddress is returned when a notifier has no way to reach the recipient
+var ErrNoAddress = errors.New("recipient has no address for this notifier")
+
+// Recipient identifies the user a notification is delivered to
+type Recipient struct {
+	UserID   int
+	Username string
+	Email    string
+}
+
+// Message is a single notification to deliver
+type Message struct {
+	To      Recipient
+	Subject string
+	Body    string
+}
+
+// Notifier delivers out-of-band messages such as password reset tokens
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Global notifier instance
+var (
+	globalNotifier     Notifier
+	globalNotifierOnce sync.Once
+)
+
+// GetNotifier returns the notifier selected by the NOTIFIER environment variable.
+// "smtp" sends email through SMTP_HOST; anything else logs messages for development.
+func GetNotifier() Notifier {
+	globalNotifierOnce.Do(func() {
+		switch strings.ToLower(os.Getenv("NOTIFIER")) {
+		case "smtp":
+			globalNotifier = NewSMTPNotifierFromEnv()
+		default:
+			notifier, err := NewLogNotifier(os.Getenv("NOTIFIER_LOG_FILE"))
+			if err != nil {
+				log.Printf("Failed to open notifier log file, logging to stderr: %v", err)
+				notifier, _ = NewLogNotifier("")
+			}
+			globalNotifier = notifier
+		}
+	})
+	return globalNotifier
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier delivers notifications as plain-text email
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPNotifierFromEnv builds an SMTP notifier from SMTP_* environment variables.
+// Leaving SMTP_USERNAME empty disables authentication, which is what local
+// mail catchers such as Mailpit expect.
+func NewSMTPNotifierFromEnv() *SMTPNotifier {
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "25"
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	return &SMTPNotifier{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+}
+
+// Notify sends the message to the recipient's email address
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	if msg.To.Email == "" {
+		return ErrNoAddress
+	}
+	if n.Host == "" {
+		return fmt.Errorf("SMTP_HOST is not configured")
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	// net/smtp has no context support, so run the send and give up when the context ends
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(n.Host, n.Port), auth, n.From, []string{msg.To.Email}, n.buildMessage(msg))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildMessage renders the RFC 5322 message
+func (n *SMTPNotifier) buildMessage(msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + n.From + "\r\n")
+	b.WriteString("To: " + msg.To.Email + "\r\n")
+	b.WriteString("Subject: " + sanitizeHeader(msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// sanitizeHeader strips line breaks to prevent header injection
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
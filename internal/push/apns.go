@@ -0,0 +1,155 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// APNs hosts
+const (
+	apnsProductionHost = "https://api.push.apple.com"
+	apnsSandboxHost    = "https://api.sandbox.push.apple.com"
+)
+
+// apnsTokenLifetime is how long a provider token is reused. APNs rejects tokens older
+// than an hour and refreshing more often than every 20 minutes.
+const apnsTokenLifetime = 45 * time.Minute
+
+// APNsProvider sends through APNs with token-based (.p8 key) authentication
+type APNsProvider struct {
+	KeyID  string
+	TeamID string
+	Topic  string // The app's bundle ID
+	Host   string
+	key    *ecdsa.PrivateKey
+	client *http.Client
+
+	mutex    sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// NewAPNsProviderFromEnv reads the signing key in APNS_KEY_FILE and the APNS_KEY_ID,
+// APNS_TEAM_ID and APNS_TOPIC settings. APNS_PRODUCTION=false uses the sandbox.
+func NewAPNsProviderFromEnv() (*APNsProvider, error) {
+	raw, err := os.ReadFile(os.Getenv("APNS_KEY_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs key: %v", err)
+	}
+
+	provider := &APNsProvider{
+		KeyID:  os.Getenv("APNS_KEY_ID"),
+		TeamID: os.Getenv("APNS_TEAM_ID"),
+		Topic:  os.Getenv("APNS_TOPIC"),
+		Host:   apnsProductionHost,
+		key:    key,
+		client: newHTTPClient(),
+	}
+	if os.Getenv("APNS_PRODUCTION") == "false" {
+		provider.Host = apnsSandboxHost
+	}
+	if provider.KeyID == "" || provider.TeamID == "" || provider.Topic == "" {
+		return nil, fmt.Errorf("APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC are required")
+	}
+	return provider, nil
+}
+
+// Send delivers an alert notification to an APNs device token
+func (p *APNsProvider) Send(ctx context.Context, device Device, n Notification) error {
+	token, err := p.providerToken()
+	if err != nil {
+		return err
+	}
+
+	aps := map[string]interface{}{
+		"alert": map[string]string{"title": n.Title, "body": n.Body},
+		"sound": "default",
+	}
+	if n.ThreadID != "" {
+		aps["thread-id"] = n.ThreadID
+	}
+	payload := map[string]interface{}{"aps": aps}
+	for key, value := range n.Data {
+		if key != "aps" {
+			payload[key] = value
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.Host+"/3/device/"+device.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("apns-topic", p.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	if n.ThreadID != "" && len(n.ThreadID) <= 64 {
+		req.Header.Set("apns-collapse-id", n.ThreadID)
+	}
+
+	resp, respBody, err := do(ctx, p.client, req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var failure struct {
+		Reason string `json:"reason"`
+	}
+	// A body that isn't JSON just leaves the reason empty
+	_ = json.Unmarshal(respBody, &failure)
+
+	switch {
+	case resp.StatusCode == http.StatusGone || failure.Reason == "BadDeviceToken" || failure.Reason == "Unregistered":
+		return ErrUnregistered
+	case failure.Reason == "ExpiredProviderToken":
+		p.mutex.Lock()
+		p.token = ""
+		p.mutex.Unlock()
+		return &TemporaryError{Err: statusError("APNs", resp, failure.Reason)}
+	}
+	return statusError("APNs", resp, failure.Reason)
+}
+
+// providerToken returns the signed JWT APNs authenticates requests with
+func (p *APNsProvider) providerToken() (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.token != "" && time.Since(p.issuedAt) < apnsTokenLifetime {
+		return p.token, nil
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": p.TeamID,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = p.KeyID
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		return "", err
+	}
+
+	p.token, p.issuedAt = signed, now
+	return p.token, nil
+}
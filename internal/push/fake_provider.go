@@ -0,0 +1,88 @@
+package push
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// maxFakeDeliveries is how many notifications the fake provider remembers; older ones are dropped
+const maxFakeDeliveries = 100
+
+// Delivery is a notification recorded by the fake provider
+type Delivery struct {
+	Device       Device
+	Notification Notification
+}
+
+// FakeProvider logs notifications to a file (or stderr) and keeps the latest in memory
+// instead of delivering them. It is meant for local development and tests. Titles and
+// bodies are not logged, they carry message content.
+type FakeProvider struct {
+	mutex  sync.Mutex
+	logger *log.Logger
+	sent   []Delivery
+	errors map[string]error
+}
+
+// NewFakeProvider creates a provider that appends to path, or logs to stderr when path is empty
+func NewFakeProvider(path string) (*FakeProvider, error) {
+	var out io.Writer = os.Stderr
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+
+	return &FakeProvider{logger: log.New(out, "[push] ", log.LstdFlags), errors: map[string]error{}}, nil
+}
+
+// Send records the notification, or returns the error set for the device token
+func (p *FakeProvider) Send(ctx context.Context, device Device, n Notification) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err, ok := p.errors[device.Token]; ok {
+		return err
+	}
+	if len(p.sent) == maxFakeDeliveries {
+		p.sent = append(p.sent[:0], p.sent[1:]...)
+	}
+	p.sent = append(p.sent, Delivery{Device: device, Notification: n})
+	p.logger.Printf("platform=%s token=%.12s… thread=%s message_id=%s",
+		device.Platform, device.Token, n.ThreadID, n.Data["message_id"])
+	return nil
+}
+
+// FailWith makes every later send to token return err; a nil err clears it
+func (p *FakeProvider) FailWith(token string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err == nil {
+		delete(p.errors, token)
+		return
+	}
+	p.errors[token] = err
+}
+
+// Sent returns the latest notifications recorded, oldest first
+func (p *FakeProvider) Sent() []Delivery {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]Delivery(nil), p.sent...)
+}
+
+// Reset forgets recorded notifications and configured errors
+func (p *FakeProvider) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.sent = nil
+	p.errors = map[string]error{}
+}
@@ -0,0 +1,190 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// fcmScope is the OAuth scope needed to send through FCM
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// FCMProvider sends through the FCM HTTP v1 API, authenticating as a service account
+type FCMProvider struct {
+	ProjectID   string
+	ClientEmail string
+	TokenURI    string
+	key         *rsa.PrivateKey
+	client      *http.Client
+
+	mutex       sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// serviceAccount is the part of a Google service account key file FCM needs
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewFCMProviderFromEnv reads the service account key file in FCM_CREDENTIALS_FILE.
+// FCM_PROJECT_ID overrides the project of the key file.
+func NewFCMProviderFromEnv() (*FCMProvider, error) {
+	raw, err := os.ReadFile(os.Getenv("FCM_CREDENTIALS_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return nil, fmt.Errorf("invalid service account file: %v", err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key: %v", err)
+	}
+
+	provider := &FCMProvider{
+		ProjectID:   account.ProjectID,
+		ClientEmail: account.ClientEmail,
+		TokenURI:    account.TokenURI,
+		key:         key,
+		client:      newHTTPClient(),
+	}
+	if projectID := os.Getenv("FCM_PROJECT_ID"); projectID != "" {
+		provider.ProjectID = projectID
+	}
+	if provider.TokenURI == "" {
+		provider.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	if provider.ProjectID == "" || provider.ClientEmail == "" {
+		return nil, fmt.Errorf("service account file has no project_id or client_email")
+	}
+	return provider, nil
+}
+
+// Send delivers a notification to an FCM registration token
+func (p *FCMProvider) Send(ctx context.Context, device Device, n Notification) error {
+	accessToken, err := p.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	android := map[string]interface{}{"priority": "high"}
+	if n.ThreadID != "" {
+		android["collapse_key"] = n.ThreadID
+	}
+	message := map[string]interface{}{
+		"token":        device.Token,
+		"notification": map[string]string{"title": n.Title, "body": n.Body},
+		"android":      android,
+	}
+	if len(n.Data) > 0 {
+		message["data"] = n.Data
+	}
+	body, err := json.Marshal(map[string]interface{}{"message": message})
+	if err != nil {
+		return err
+	}
+
+	endpoint := "https://fcm.googleapis.com/v1/projects/" + url.PathEscape(p.ProjectID) + "/messages:send"
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, respBody, err := do(ctx, p.client, req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var failure struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	// A body that isn't JSON just leaves the reason empty
+	_ = json.Unmarshal(respBody, &failure)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || strings.Contains(string(respBody), `"UNREGISTERED"`):
+		return ErrUnregistered
+	case resp.StatusCode == http.StatusUnauthorized:
+		// The access token was revoked or expired early, fetch a new one next time
+		p.mutex.Lock()
+		p.accessToken = ""
+		p.mutex.Unlock()
+		return &TemporaryError{Err: statusError("FCM", resp, failure.Error.Message)}
+	}
+	return statusError("FCM", resp, failure.Error.Message)
+}
+
+// token returns a cached OAuth access token, exchanging a signed assertion for a new
+// one shortly before it expires
+func (p *FCMProvider) token(ctx context.Context) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.accessToken != "" && time.Now().Before(p.expiresAt.Add(-time.Minute)) {
+		return p.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   p.ClientEmail,
+		"scope": fcmScope,
+		"aud":   p.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(p.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequest(http.MethodPost, p.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, body, err := do(ctx, p.client, req)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError("Google OAuth", resp, string(body))
+	}
+
+	var grant struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &grant); err != nil || grant.AccessToken == "" {
+		return "", fmt.Errorf("push: unexpected Google OAuth response")
+	}
+
+	p.accessToken = grant.AccessToken
+	p.expiresAt = now.Add(time.Duration(grant.ExpiresIn) * time.Second)
+	return p.accessToken, nil
+}
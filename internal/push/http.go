@@ -0,0 +1,68 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// requestTimeout bounds a single call to a push service
+const requestTimeout = 10 * time.Second
+
+// maxErrorBody is how much of an error response is read for its reason
+const maxErrorBody = 4096
+
+// newHTTPClient returns the client push services are called with. The default transport
+// negotiates HTTP/2, which APNs requires.
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: requestTimeout}
+}
+
+// do sends req and returns the response along with the start of its body. Transport
+// failures are temporary.
+func do(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, []byte, error) {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, &TemporaryError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil {
+		return resp, nil, &TemporaryError{Err: err}
+	}
+	return resp, body, nil
+}
+
+// statusError turns a failed response into an error. Rate limits and server errors are
+// temporary; anything else is not.
+func statusError(service string, resp *http.Response, reason string) error {
+	err := fmt.Errorf("push: %s returned %s: %s", service, resp.Status, reason)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return &TemporaryError{Err: err, RetryAfter: retryAfter(resp)}
+	}
+	return err
+}
+
+// retryAfter reads the Retry-After header, in seconds or as a date
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
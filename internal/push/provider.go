@@ -0,0 +1,177 @@
+// Package push delivers notifications to mobile and browser devices through FCM,
+// APNs and Web Push.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device platforms
+const (
+	PlatformFCM     = "fcm"     // Android, through Firebase Cloud Messaging
+	PlatformAPNs    = "apns"    // iOS and macOS, through the Apple Push Notification service
+	PlatformWebPush = "webpush" // Browsers; the token is the JSON push subscription
+)
+
+var (
+	// ErrUnregistered is returned when the device token is no longer valid and should be forgotten
+	ErrUnregistered = errors.New("push: device token is no longer registered")
+	// ErrUnsupportedPlatform is returned when no provider is configured for a device's platform
+	ErrUnsupportedPlatform = errors.New("push: no provider for this platform")
+)
+
+// Device is a registered device to deliver to
+type Device struct {
+	Platform string
+	Token    string
+}
+
+// Notification is a single notification shown on a device
+type Notification struct {
+	Title    string
+	Body     string
+	ThreadID string            // Groups notifications of one conversation
+	Data     map[string]string // Passed to the app along with the notification
+}
+
+// Provider delivers notifications to devices
+type Provider interface {
+	Send(ctx context.Context, device Device, n Notification) error
+}
+
+// TemporaryError wraps a failure that may succeed when retried, such as a network error or a
+// rate limit. RetryAfter is the delay the push service asked for, zero when it didn't say.
+type TemporaryError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *TemporaryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TemporaryError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether err may go away when the notification is sent again, and the
+// delay the push service asked for
+func Retryable(err error) (bool, time.Duration) {
+	var temporary *TemporaryError
+	if errors.As(err, &temporary) {
+		return true, temporary.RetryAfter
+	}
+	return false, 0
+}
+
+// Router sends each notification through the provider of the device's platform
+type Router map[string]Provider
+
+// Send delivers through the provider configured for device.Platform
+func (r Router) Send(ctx context.Context, device Device, n Notification) error {
+	provider, ok := r[device.Platform]
+	if !ok {
+		return ErrUnsupportedPlatform
+	}
+	return provider.Send(ctx, device, n)
+}
+
+// Global provider instance
+var (
+	globalProvider     Provider
+	globalProviderOnce sync.Once
+)
+
+// GetProvider returns the push provider selected by the PUSH_PROVIDER environment variable,
+// or nil when no provider is configured and notifications can't be sent.
+func GetProvider() Provider {
+	globalProviderOnce.Do(func() {
+		globalProvider = newProviderFromEnv()
+	})
+	return globalProvider
+}
+
+// newProviderFromEnv builds the provider selected by PUSH_PROVIDER. "live" (the default)
+// delivers through every platform whose credentials are configured (FCM_*, APNS_*, VAPID_*).
+// "fake" must be chosen explicitly: it only logs to stderr or PUSH_LOG_FILE, for local
+// development.
+func newProviderFromEnv() Provider {
+	switch strings.ToLower(os.Getenv("PUSH_PROVIDER")) {
+	case "", "live":
+		router := newRouterFromEnv()
+		if len(router) == 0 {
+			return nil
+		}
+		return router
+	case "fake":
+		provider, err := NewFakeProvider(os.Getenv("PUSH_LOG_FILE"))
+		if err != nil {
+			log.Printf("Failed to open push log file, logging to stderr: %v", err)
+			provider, _ = NewFakeProvider("")
+		}
+		return provider
+	default:
+		log.Printf("Unknown PUSH_PROVIDER %q, push notifications disabled", os.Getenv("PUSH_PROVIDER"))
+		return nil
+	}
+}
+
+// newRouterFromEnv builds the providers whose credentials are configured. A platform whose
+// configuration is broken is left out, so its devices fail with ErrUnsupportedPlatform.
+func newRouterFromEnv() Router {
+	router := Router{}
+	add := func(platform string, configured bool, build func() (Provider, error)) {
+		if !configured {
+			return
+		}
+		provider, err := build()
+		if err != nil {
+			log.Printf("Push notifications through %s disabled: %v", platform, err)
+			return
+		}
+		router[platform] = provider
+	}
+
+	add(PlatformFCM, os.Getenv("FCM_CREDENTIALS_FILE") != "", func() (Provider, error) {
+		return NewFCMProviderFromEnv()
+	})
+	add(PlatformAPNs, os.Getenv("APNS_KEY_FILE") != "", func() (Provider, error) {
+		return NewAPNsProviderFromEnv()
+	})
+	add(PlatformWebPush, os.Getenv("VAPID_PRIVATE_KEY") != "", func() (Provider, error) {
+		return NewWebPushProviderFromEnv()
+	})
+
+	if len(router) == 0 {
+		log.Printf("No push platform is configured")
+	}
+	return router
+}
+
+// ValidateToken checks a device token before it is registered
+func ValidateToken(platform, token string) error {
+	switch platform {
+	case PlatformFCM:
+		if len(token) < 32 || len(token) > 4096 || strings.ContainsAny(token, " \t\r\n") {
+			return fmt.Errorf("invalid FCM registration token")
+		}
+	case PlatformAPNs:
+		if len(token) < 64 || len(token) > 200 || strings.Trim(strings.ToLower(token), "0123456789abcdef") != "" {
+			return fmt.Errorf("APNs device tokens must be hex encoded")
+		}
+	case PlatformWebPush:
+		if _, err := parseSubscription(token); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("platform must be one of fcm, apns or webpush")
+	}
+	return nil
+}
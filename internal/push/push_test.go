@@ -0,0 +1,247 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// response builds a push service response with the given status and headers
+func response(status int, header ...string) *http.Response {
+	resp := &http.Response{StatusCode: status, Status: fmt.Sprintf("%d %s", status, http.StatusText(status)), Header: http.Header{}}
+	for i := 0; i+1 < len(header); i += 2 {
+		resp.Header.Set(header[i], header[i+1])
+	}
+	return resp
+}
+
+func TestStatusErrorRetryable(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       *http.Response
+		retryable  bool
+		retryAfter time.Duration
+	}{
+		{"rate limited", response(http.StatusTooManyRequests, "Retry-After", "120"), true, 2 * time.Minute},
+		{"rate limited without Retry-After", response(http.StatusTooManyRequests), true, 0},
+		{"server error", response(http.StatusInternalServerError), true, 0},
+		{"unavailable", response(http.StatusServiceUnavailable, "Retry-After", "30"), true, 30 * time.Second},
+		{"bad request", response(http.StatusBadRequest), false, 0},
+		{"forbidden", response(http.StatusForbidden), false, 0},
+		{"gone", response(http.StatusGone), false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := statusError("Test", tt.resp, "reason")
+			if err == nil || !strings.Contains(err.Error(), "reason") {
+				t.Fatalf("statusError = %v, want an error with the reason", err)
+			}
+			retryable, retryAfter := Retryable(err)
+			if retryable != tt.retryable || retryAfter != tt.retryAfter {
+				t.Errorf("Retryable = (%v, %s), want (%v, %s)", retryable, retryAfter, tt.retryable, tt.retryAfter)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	if retryable, _ := Retryable(ErrUnregistered); retryable {
+		t.Error("ErrUnregistered is retryable, want permanent")
+	}
+	if retryable, _ := Retryable(errors.New("boom")); retryable {
+		t.Error("plain errors are retryable, want permanent")
+	}
+
+	wrapped := fmt.Errorf("sending: %w", &TemporaryError{Err: errors.New("timeout"), RetryAfter: time.Second})
+	if retryable, retryAfter := Retryable(wrapped); !retryable || retryAfter != time.Second {
+		t.Errorf("Retryable(wrapped) = (%v, %s), want (true, 1s)", retryable, retryAfter)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if got := retryAfter(response(http.StatusTooManyRequests, "Retry-After", "5")); got != 5*time.Second {
+		t.Errorf("seconds: got %s, want 5s", got)
+	}
+
+	at := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := retryAfter(response(http.StatusTooManyRequests, "Retry-After", at)); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("date: got %s, want about an hour", got)
+	}
+
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	for _, value := range []string{"", "soon", "-5", past} {
+		if got := retryAfter(response(http.StatusTooManyRequests, "Retry-After", value)); got != 0 {
+			t.Errorf("Retry-After %q: got %s, want 0", value, got)
+		}
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	sub := newTestSubscription(t, "https://fcm.googleapis.com/fcm/send/abc")
+
+	tests := []struct {
+		name     string
+		platform string
+		token    string
+		valid    bool
+	}{
+		{"fcm", PlatformFCM, "dGhpcyBpcyBhbiBGQ00gcmVnaXN0cmF0aW9uIHRva2Vu:APA91bH", true},
+		{"fcm too short", PlatformFCM, "short", false},
+		{"fcm with whitespace", PlatformFCM, strings.Repeat("a", 20) + " " + strings.Repeat("b", 20), false},
+		{"apns", PlatformAPNs, strings.Repeat("a1B2", 16), true},
+		{"apns not hex", PlatformAPNs, strings.Repeat("zz", 32), false},
+		{"apns too short", PlatformAPNs, "abcdef", false},
+		{"webpush", PlatformWebPush, sub.token, true},
+		{"webpush not json", PlatformWebPush, "https://fcm.googleapis.com/fcm/send/abc", false},
+		{"webpush unknown host", PlatformWebPush, newTestSubscription(t, "https://push.example.com/abc").token, false},
+		{"webpush internal host", PlatformWebPush, newTestSubscription(t, "https://169.254.169.254/latest").token, false},
+		{"webpush lookalike host", PlatformWebPush, newTestSubscription(t, "https://evilfcm.googleapis.com.example.com/abc").token, false},
+		{"webpush http", PlatformWebPush, newTestSubscription(t, "http://fcm.googleapis.com/fcm/send/abc").token, false},
+		{"webpush bad keys", PlatformWebPush, `{"endpoint":"https://fcm.googleapis.com/x","keys":{"p256dh":"AAAA","auth":"AAAA"}}`, false},
+		{"unknown platform", "sms", "+15551234567", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateToken(tt.platform, tt.token)
+			if tt.valid && err != nil {
+				t.Errorf("ValidateToken = %v, want valid", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("ValidateToken succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestWebPushAllowedHosts(t *testing.T) {
+	t.Setenv("WEBPUSH_ALLOWED_HOSTS", "push.example.com")
+
+	if !allowedWebPushHost("push.example.com") || !allowedWebPushHost("eu.PUSH.example.com") {
+		t.Error("configured host not allowed")
+	}
+	if allowedWebPushHost("fcm.googleapis.com") {
+		t.Error("default host allowed although WEBPUSH_ALLOWED_HOSTS replaces the defaults")
+	}
+}
+
+func TestRouter(t *testing.T) {
+	fake, err := NewFakeProvider("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := Router{PlatformFCM: fake}
+	n := Notification{Title: "Alice", Body: "Hi"}
+
+	if err := router.Send(context.Background(), Device{Platform: PlatformFCM, Token: "one"}, n); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := router.Send(context.Background(), Device{Platform: PlatformAPNs, Token: "two"}, n); !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Errorf("Send to an unconfigured platform = %v, want ErrUnsupportedPlatform", err)
+	}
+
+	sent := fake.Sent()
+	if len(sent) != 1 || sent[0].Device.Token != "one" || sent[0].Notification.Body != "Hi" {
+		t.Errorf("Sent = %+v, want the one FCM notification", sent)
+	}
+}
+
+func TestFakeProvider(t *testing.T) {
+	fake, err := NewFakeProvider("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := Device{Platform: PlatformFCM, Token: "token"}
+
+	fake.FailWith("token", ErrUnregistered)
+	if err := fake.Send(context.Background(), device, Notification{}); !errors.Is(err, ErrUnregistered) {
+		t.Errorf("Send = %v, want the configured error", err)
+	}
+	if len(fake.Sent()) != 0 {
+		t.Error("failed send was recorded")
+	}
+
+	fake.FailWith("token", nil)
+	if err := fake.Send(context.Background(), device, Notification{}); err != nil {
+		t.Errorf("Send after clearing the error = %v", err)
+	}
+	if len(fake.Sent()) != 1 {
+		t.Errorf("Sent has %d notifications, want 1", len(fake.Sent()))
+	}
+
+	fake.FailWith("token", &TemporaryError{Err: errors.New("unavailable")})
+	fake.Reset()
+	if len(fake.Sent()) != 0 {
+		t.Error("Reset kept recorded notifications")
+	}
+	if err := fake.Send(context.Background(), device, Notification{}); err != nil {
+		t.Errorf("Reset kept the configured error: %v", err)
+	}
+}
+
+func TestProviderFromEnv(t *testing.T) {
+	for _, key := range []string{"FCM_CREDENTIALS_FILE", "APNS_KEY_FILE", "VAPID_PRIVATE_KEY"} {
+		t.Setenv(key, "")
+	}
+
+	for _, setting := range []string{"", "live", "LIVE", "unknown"} {
+		t.Setenv("PUSH_PROVIDER", setting)
+		if provider := newProviderFromEnv(); provider != nil {
+			t.Errorf("PUSH_PROVIDER=%q without credentials gave %T, want none", setting, provider)
+		}
+	}
+
+	t.Setenv("PUSH_PROVIDER", "fake")
+	if _, ok := newProviderFromEnv().(*FakeProvider); !ok {
+		t.Error("PUSH_PROVIDER=fake didn't give the fake provider")
+	}
+}
+
+func TestFakeProviderKeepsLatestDeliveries(t *testing.T) {
+	fake, err := NewFakeProvider("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := Device{Platform: PlatformFCM, Token: "token"}
+	for i := 0; i < maxFakeDeliveries+10; i++ {
+		if err := fake.Send(context.Background(), device, Notification{Body: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sent := fake.Sent()
+	if len(sent) != maxFakeDeliveries {
+		t.Fatalf("kept %d notifications, want %d", len(sent), maxFakeDeliveries)
+	}
+	if first, last := sent[0].Notification.Body, sent[len(sent)-1].Notification.Body; first != "10" || last != fmt.Sprint(maxFakeDeliveries+9) {
+		t.Errorf("kept notifications %s to %s, want the latest", first, last)
+	}
+}
+
+func TestFakeProviderDoesNotLogContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push.log")
+	fake, err := NewFakeProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := Notification{Title: "Secret title", Body: "Secret body", ThreadID: "dm-1", Data: map[string]string{"message_id": "7"}}
+	if err := fake.Send(context.Background(), Device{Platform: PlatformFCM, Token: "token"}, n); err != nil {
+		t.Fatal(err)
+	}
+
+	logged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(logged), "Secret") {
+		t.Errorf("log contains message content: %s", logged)
+	}
+	if !strings.Contains(string(logged), "message_id=7") {
+		t.Errorf("log doesn't identify the message: %s", logged)
+	}
+}
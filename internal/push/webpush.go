@@ -0,0 +1,287 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// webPushTTL is how long a push service keeps a notification for an offline browser
+const webPushTTL = 24 * time.Hour
+
+// webPushRecordSize is the aes128gcm record size; payloads are sent as a single record
+const webPushRecordSize = 4096
+
+// defaultWebPushHosts are the push services of the major browsers
+const defaultWebPushHosts = "fcm.googleapis.com,updates.push.services.mozilla.com,push.services.mozilla.com," +
+	"web.push.apple.com,notify.windows.com"
+
+// webPushTopic matches the values the Topic header accepts
+var webPushTopic = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// subscription is a browser push subscription, the token of a webpush device
+type subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// parsedSubscription is a subscription with its keys decoded
+type parsedSubscription struct {
+	endpoint   *url.URL
+	publicKey  *ecdh.PublicKey
+	authSecret []byte
+}
+
+// parseSubscription decodes and checks a push subscription. Endpoints must be https URLs on
+// the push services in WEBPUSH_ALLOWED_HOSTS, so the server can't be made to post
+// anywhere else.
+func parseSubscription(token string) (parsedSubscription, error) {
+	var parsed parsedSubscription
+	var sub subscription
+	if err := json.Unmarshal([]byte(token), &sub); err != nil {
+		return parsed, fmt.Errorf("webpush tokens must be a JSON push subscription")
+	}
+
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.User != nil || !allowedWebPushHost(endpoint.Hostname()) {
+		return parsed, fmt.Errorf("push subscription endpoint is not a known push service")
+	}
+
+	publicKey, err := decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return parsed, fmt.Errorf("push subscription p256dh key is invalid")
+	}
+	parsed.publicKey, err = ecdh.P256().NewPublicKey(publicKey)
+	if err != nil {
+		return parsed, fmt.Errorf("push subscription p256dh key is invalid")
+	}
+	parsed.authSecret, err = decodeBase64URL(sub.Keys.Auth)
+	if err != nil || len(parsed.authSecret) != 16 {
+		return parsed, fmt.Errorf("push subscription auth secret is invalid")
+	}
+	parsed.endpoint = endpoint
+	return parsed, nil
+}
+
+// allowedWebPushHost reports whether host is, or is under, one of the allowed push services
+func allowedWebPushHost(host string) bool {
+	allowed := os.Getenv("WEBPUSH_ALLOWED_HOSTS")
+	if allowed == "" {
+		allowed = defaultWebPushHosts
+	}
+	host = strings.ToLower(host)
+	for _, service := range strings.Split(allowed, ",") {
+		service = strings.ToLower(strings.TrimSpace(service))
+		if service != "" && (host == service || strings.HasSuffix(host, "."+service)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeBase64URL decodes base64url with or without padding, as browsers send both
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// WebPushProvider sends encrypted Web Push messages (RFC 8291) authenticated with VAPID (RFC 8292)
+type WebPushProvider struct {
+	Subject   string // mailto: or https: contact for the push service operator
+	key       *ecdsa.PrivateKey
+	publicKey string // base64url, sent with every request
+	client    *http.Client
+}
+
+// NewWebPushProviderFromEnv reads the VAPID key pair from VAPID_PRIVATE_KEY (the base64url
+// private key, as generated by web-push tools) and the contact from VAPID_SUBJECT
+func NewWebPushProviderFromEnv() (*WebPushProvider, error) {
+	raw, err := decodeBase64URL(os.Getenv("VAPID_PRIVATE_KEY"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %v", err)
+	}
+	private, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %v", err)
+	}
+
+	// Uncompressed point: 0x04 || X || Y
+	public := private.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}
+
+	subject := os.Getenv("VAPID_SUBJECT")
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https://") {
+		return nil, fmt.Errorf("VAPID_SUBJECT must be a mailto: or https: URL")
+	}
+
+	return &WebPushProvider{
+		Subject:   subject,
+		key:       key,
+		publicKey: base64.RawURLEncoding.EncodeToString(public),
+		client:    newHTTPClient(),
+	}, nil
+}
+
+// Send encrypts the notification for the subscription and posts it to its push service
+func (p *WebPushProvider) Send(ctx context.Context, device Device, n Notification) error {
+	sub, err := parseSubscription(device.Token)
+	if err != nil {
+		return ErrUnregistered
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"title":     n.Title,
+		"body":      n.Body,
+		"thread_id": n.ThreadID,
+		"data":      n.Data,
+	})
+	if err != nil {
+		return err
+	}
+	body, err := encryptWebPush(sub, payload)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := p.vapidAuthorization(sub.endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", fmt.Sprint(int(webPushTTL.Seconds())))
+	req.Header.Set("Urgency", "high")
+	if webPushTopic.MatchString(n.ThreadID) {
+		req.Header.Set("Topic", n.ThreadID)
+	}
+
+	resp, respBody, err := do(ctx, p.client, req)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrUnregistered
+	}
+	return statusError("Web Push", resp, string(respBody))
+}
+
+// vapidAuthorization signs the VAPID token for the push service of endpoint
+func (p *WebPushProvider) vapidAuthorization(endpoint *url.URL) (string, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": p.Subject,
+	}).SignedString(p.key)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + token + ", k=" + p.publicKey, nil
+}
+
+// encryptWebPush encrypts payload for a subscription with the aes128gcm content coding,
+// as a single record
+func encryptWebPush(sub parsedSubscription, payload []byte) ([]byte, error) {
+	// Push services take at most 4096 bytes: the 86 byte header, then the payload, its
+	// delimiter and the 16 byte tag
+	if 86+len(payload)+1+16 > webPushRecordSize {
+		return nil, fmt.Errorf("push: Web Push payload too large")
+	}
+
+	// A fresh key pair per message; its public key travels in the header
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(sub.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	// RFC 8291 section 3.4: mix the auth secret and both public keys into the input key
+	senderPublic := ephemeral.PublicKey().Bytes()
+	keyInfo := "WebPush: info\x00" + string(sub.publicKey.Bytes()) + string(senderPublic)
+	prkKey, err := hkdf.Extract(sha256.New, shared, sub.authSecret)
+	if err != nil {
+		return nil, err
+	}
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	// RFC 8188: content encryption key and nonce
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt || record size || key ID length || key ID (the sender public key)
+	header := make([]byte, 0, 16+4+1+len(senderPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(senderPublic)))
+	header = append(header, senderPublic...)
+
+	// 0x02 marks the last (and only) record
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
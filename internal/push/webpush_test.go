@@ -0,0 +1,190 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// testSubscription is a browser subscription along with the keys only the browser knows
+type testSubscription struct {
+	token      string
+	privateKey *ecdh.PrivateKey
+	authSecret []byte
+}
+
+// newTestSubscription creates a subscription for endpoint the way a browser would
+func newTestSubscription(t *testing.T, endpoint string) testSubscription {
+	t.Helper()
+	privateKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSecret := make([]byte, 16)
+	if _, err := rand.Read(authSecret); err != nil {
+		t.Fatal(err)
+	}
+
+	var sub subscription
+	sub.Endpoint = endpoint
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(privateKey.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(authSecret)
+	token, err := json.Marshal(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSubscription{token: string(token), privateKey: privateKey, authSecret: authSecret}
+}
+
+// decrypt undoes encryptWebPush as the browser does (RFC 8291 and RFC 8188)
+func (s testSubscription) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	if len(body) < 21 {
+		t.Fatalf("body of %d bytes has no header", len(body))
+	}
+	salt := body[:16]
+	if recordSize := binary.BigEndian.Uint32(body[16:20]); recordSize != webPushRecordSize {
+		t.Errorf("record size = %d, want %d", recordSize, webPushRecordSize)
+	}
+	keyIDLength := int(body[20])
+	senderPublic := body[21 : 21+keyIDLength]
+	ciphertext := body[21+keyIDLength:]
+
+	senderKey, err := ecdh.P256().NewPublicKey(senderPublic)
+	if err != nil {
+		t.Fatalf("sender key: %v", err)
+	}
+	shared, err := s.privateKey.ECDH(senderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyInfo := "WebPush: info\x00" + string(s.privateKey.PublicKey().Bytes()) + string(senderPublic)
+	prkKey, _ := hkdf.Extract(sha256.New, shared, s.authSecret)
+	ikm, _ := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	prk, _ := hkdf.Extract(sha256.New, ikm, salt)
+	cek, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("decrypting: %v", err)
+	}
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatal("missing last record delimiter")
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+func TestEncryptWebPush(t *testing.T) {
+	sub := newTestSubscription(t, "https://fcm.googleapis.com/fcm/send/abc")
+	parsed, err := parseSubscription(sub.token)
+	if err != nil {
+		t.Fatalf("parseSubscription: %v", err)
+	}
+
+	payload := []byte(`{"title":"Alice","body":"Hello 👋"}`)
+	body, err := encryptWebPush(parsed, payload)
+	if err != nil {
+		t.Fatalf("encryptWebPush: %v", err)
+	}
+	if got := sub.decrypt(t, body); !bytes.Equal(got, payload) {
+		t.Errorf("decrypted %q, want %q", got, payload)
+	}
+
+	// Every message uses a fresh salt and key pair
+	again, err := encryptWebPush(parsed, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(body[:86], again[:86]) {
+		t.Error("two messages share a header")
+	}
+
+	if _, err := encryptWebPush(parsed, make([]byte, webPushRecordSize)); err == nil {
+		t.Error("oversized payload was encrypted")
+	}
+}
+
+func TestWebPushSend(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	status := http.StatusCreated
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	t.Setenv("WEBPUSH_ALLOWED_HOSTS", serverURL.Hostname())
+	vapidKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VAPID_PRIVATE_KEY", base64.RawURLEncoding.EncodeToString(vapidKey.Bytes()))
+	t.Setenv("VAPID_SUBJECT", "mailto:admin@example.com")
+
+	provider, err := NewWebPushProviderFromEnv()
+	if err != nil {
+		t.Fatalf("NewWebPushProviderFromEnv: %v", err)
+	}
+	provider.client = server.Client()
+
+	sub := newTestSubscription(t, server.URL+"/push/abc")
+	device := Device{Platform: PlatformWebPush, Token: sub.token}
+	n := Notification{Title: "Alice", Body: "Hi", ThreadID: "dm-1", Data: map[string]string{"message_id": "7"}}
+
+	if err := provider.Send(context.Background(), device, n); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.URL.Path != "/push/abc" || got.Header.Get("Content-Encoding") != "aes128gcm" || got.Header.Get("Topic") != "dm-1" {
+		t.Errorf("unexpected request %s %v", got.URL.Path, got.Header)
+	}
+	wantAuth := "vapid t="
+	if auth := got.Header.Get("Authorization"); !strings.HasPrefix(auth, wantAuth) ||
+		!strings.HasSuffix(auth, ", k="+base64.RawURLEncoding.EncodeToString(vapidKey.PublicKey().Bytes())) {
+		t.Errorf("Authorization = %q", auth)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(sub.decrypt(t, gotBody), &payload); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if payload["title"] != "Alice" || payload["body"] != "Hi" || payload["thread_id"] != "dm-1" {
+		t.Errorf("payload = %v", payload)
+	}
+
+	status = http.StatusGone
+	if err := provider.Send(context.Background(), device, n); err != ErrUnregistered {
+		t.Errorf("Send to an expired subscription = %v, want ErrUnregistered", err)
+	}
+
+	status = http.StatusTooManyRequests
+	if retryable, _ := Retryable(provider.Send(context.Background(), device, n)); !retryable {
+		t.Error("rate limited send is not retryable")
+	}
+}
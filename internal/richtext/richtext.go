@@ -0,0 +1,201 @@
+// Package richtext finds @mentions and links in message text and turns them into
+// rendering hints, so every client highlights the same spans the same way.
+package richtext
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Text formats
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// Entity types
+const (
+	EntityMention = "mention"
+	EntityLink    = "link"
+)
+
+// maxEntities caps the hints of a single message
+const maxEntities = 100
+
+var (
+	// mentionPattern matches @username using the registration rules for usernames
+	mentionPattern = regexp.MustCompile(`@([A-Za-z][A-Za-z0-9_.]{2,29})`)
+	// linkPattern matches bare http(s) URLs
+	linkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'` + "`" + `]+`)
+)
+
+// Entity is a span of the text clients should render specially. Offset and Length
+// count UTF-16 code units, which is how JavaScript, Android and iOS index strings.
+type Entity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	UserID int    `json:"user_id,omitempty"` // Mentions
+	URL    string `json:"url,omitempty"`     // Links
+}
+
+// Hints tell clients how to render a message. Raw HTML is never rendered, in
+// markdown either, and only http(s) URLs become links.
+type Hints struct {
+	Format   string   `json:"format"`
+	Entities []Entity `json:"entities,omitempty"`
+}
+
+// span is a match in the text, by byte offsets
+type span struct {
+	start, end int
+	value      string
+}
+
+// MentionedUsernames returns the distinct usernames mentioned in text, in order of appearance
+func MentionedUsernames(text string) []string {
+	var usernames []string
+	seen := map[string]bool{}
+	for _, m := range mentions(text) {
+		if !seen[m.value] {
+			seen[m.value] = true
+			usernames = append(usernames, m.value)
+		}
+	}
+	return usernames
+}
+
+// Links returns the distinct http(s) URLs in text, in order of appearance
+func Links(text string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, l := range links(text) {
+		if !seen[l.value] {
+			seen[l.value] = true
+			urls = append(urls, l.value)
+		}
+	}
+	return urls
+}
+
+// Analyze builds the rendering hints of text. userIDs maps the usernames that may be
+// mentioned to their IDs; other @names are left as plain text.
+func Analyze(text, format string, userIDs map[string]int) Hints {
+	hints := Hints{Format: format}
+
+	linkSpans := links(text)
+	var spans []Entity
+	for _, l := range linkSpans {
+		spans = append(spans, entity(text, l, Entity{Type: EntityLink, URL: l.value}))
+	}
+	for _, m := range mentions(text) {
+		userID, ok := userIDs[m.value]
+		if !ok || insideAny(m, linkSpans) {
+			continue
+		}
+		spans = append(spans, entity(text, m, Entity{Type: EntityMention, UserID: userID}))
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Offset < spans[j].Offset })
+	if len(spans) > maxEntities {
+		spans = spans[:maxEntities]
+	}
+	hints.Entities = spans
+	return hints
+}
+
+// mentions finds @username spans that aren't part of a word or an email address
+func mentions(text string) []span {
+	var found []span
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		if loc[0] > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(text[:loc[0]])
+			if prev == '_' || prev == '.' || prev == '@' || isWordRune(prev) {
+				continue
+			}
+		}
+		// A trailing dot ends the sentence rather than the username
+		end := loc[1]
+		for text[end-1] == '.' {
+			end--
+		}
+		if end-loc[2] < 3 {
+			continue
+		}
+		found = append(found, span{start: loc[0], end: end, value: text[loc[2]:end]})
+	}
+	return found
+}
+
+// links finds http(s) URLs, leaving out trailing punctuation and anything that doesn't parse
+func links(text string) []span {
+	var found []span
+	for _, loc := range linkPattern.FindAllStringIndex(text, -1) {
+		end := loc[0] + len(trimTrailingPunctuation(text[loc[0]:loc[1]]))
+		raw := text[loc[0]:end]
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		found = append(found, span{start: loc[0], end: end, value: raw})
+	}
+	return found
+}
+
+// trimTrailingPunctuation drops sentence punctuation after a URL, and a closing
+// bracket unless the URL contains the matching opening one
+func trimTrailingPunctuation(raw string) string {
+	for len(raw) > 0 {
+		last := raw[len(raw)-1]
+		switch last {
+		case '.', ',', ';', ':', '!', '?':
+		case ')':
+			if strings.Count(raw, "(") >= strings.Count(raw, ")") {
+				return raw
+			}
+		case ']':
+			if strings.Count(raw, "[") >= strings.Count(raw, "]") {
+				return raw
+			}
+		default:
+			return raw
+		}
+		raw = raw[:len(raw)-1]
+	}
+	return raw
+}
+
+// entity converts a byte span into an entity with UTF-16 offsets
+func entity(text string, s span, e Entity) Entity {
+	e.Offset = utf16Len(text[:s.start])
+	e.Length = utf16Len(text[s.start:s.end])
+	return e
+}
+
+// insideAny reports whether s overlaps one of spans
+func insideAny(s span, spans []span) bool {
+	for _, other := range spans {
+		if s.start < other.end && other.start < s.end {
+			return true
+		}
+	}
+	return false
+}
+
+// utf16Len counts the UTF-16 code units of s
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// isWordRune reports whether r would make an @ part of a word, like in an email address
+func isWordRune(r rune) bool {
+	return r == '-' || r == '+' || ('0' <= r && r <= '9') || ('A' <= r && r <= 'Z') || ('a' <= r && r <= 'z')
+}
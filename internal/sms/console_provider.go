@@ -0,0 +1,39 @@
+package sms
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// ConsoleProvider writes text messages to a log file (or stderr) instead of sending them.
+// It is meant for local development and testing.
+type ConsoleProvider struct {
+	mutex  sync.Mutex
+	logger *log.Logger
+}
+
+// NewConsoleProvider creates a provider that appends to path, or logs to stderr when path is empty
+func NewConsoleProvider(path string) (*ConsoleProvider, error) {
+	var out io.Writer = os.Stderr
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+
+	return &ConsoleProvider{logger: log.New(out, "[sms] ", log.LstdFlags)}, nil
+}
+
+// Send records the message
+func (p *ConsoleProvider) Send(ctx context.Context, to string, body string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.logger.Printf("to=%s body=%q", to, body)
+	return nil
+}
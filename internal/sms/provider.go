@@ -0,0 +1,40 @@
+package sms
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Provider sends text messages to phone numbers in E.164 format
+type Provider interface {
+	Send(ctx context.Context, to string, body string) error
+}
+
+// Global provider instance
+var (
+	globalProvider     Provider
+	globalProviderOnce sync.Once
+)
+
+// GetProvider returns the SMS provider selected by the SMS_PROVIDER environment variable.
+// Only the "console" provider ships with the project; it logs messages to stderr or SMS_LOG_FILE.
+func GetProvider() Provider {
+	globalProviderOnce.Do(func() {
+		switch strings.ToLower(os.Getenv("SMS_PROVIDER")) {
+		case "", "console":
+		default:
+			log.Printf("Unknown SMS_PROVIDER %q, falling back to console", os.Getenv("SMS_PROVIDER"))
+		}
+
+		provider, err := NewConsoleProvider(os.Getenv("SMS_LOG_FILE"))
+		if err != nil {
+			log.Printf("Failed to open SMS log file, logging to stderr: %v", err)
+			provider, _ = NewConsoleProvider("")
+		}
+		globalProvider = provider
+	})
+	return globalProvider
+}
@@ -0,0 +1,126 @@
+package unfurl
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Length caps for preview fields, in runes
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 500
+	maxSiteNameLength    = 100
+	maxImageURLLength    = 2048
+)
+
+// parsePreview reads OpenGraph tags from the head of an HTML page, falling back to
+// <title> and the description meta tag. base resolves relative image URLs.
+func parsePreview(r io.Reader, base *url.URL) Preview {
+	var preview Preview
+	var fallbackTitle, fallbackDescription string
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			// End of the page, or of what MaxBytes let us read
+			return finishPreview(preview, fallbackTitle, fallbackDescription, base)
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			switch token.DataAtom {
+			case atom.Body:
+				// Metadata lives in the head, no need to read the rest of the page
+				return finishPreview(preview, fallbackTitle, fallbackDescription, base)
+			case atom.Title:
+				inTitle = fallbackTitle == ""
+			case atom.Meta:
+				key, content := metaAttributes(token)
+				switch key {
+				case "og:title":
+					setOnce(&preview.Title, content)
+				case "og:description":
+					setOnce(&preview.Description, content)
+				case "og:image", "og:image:url", "og:image:secure_url":
+					setOnce(&preview.ImageURL, content)
+				case "og:site_name":
+					setOnce(&preview.SiteName, content)
+				case "description":
+					setOnce(&fallbackDescription, content)
+				}
+			}
+
+		case html.TextToken:
+			if inTitle {
+				fallbackTitle += string(z.Text())
+			}
+
+		case html.EndTagToken:
+			if inTitle {
+				inTitle = false
+			}
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.Head {
+				return finishPreview(preview, fallbackTitle, fallbackDescription, base)
+			}
+		}
+	}
+}
+
+// metaAttributes returns the property (or name) and content of a meta tag
+func metaAttributes(token html.Token) (string, string) {
+	var key, content string
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(attr.Val))
+			}
+		case "content":
+			content = attr.Val
+		}
+	}
+	return key, content
+}
+
+// setOnce keeps the first non-empty value seen for a field
+func setOnce(field *string, value string) {
+	if *field == "" {
+		*field = strings.TrimSpace(value)
+	}
+}
+
+// finishPreview applies fallbacks and cleans up every field
+func finishPreview(preview Preview, fallbackTitle, fallbackDescription string, base *url.URL) Preview {
+	if preview.Title == "" {
+		preview.Title = fallbackTitle
+	}
+	if preview.Description == "" {
+		preview.Description = fallbackDescription
+	}
+	preview.Title = cleanText(preview.Title, maxTitleLength)
+	preview.Description = cleanText(preview.Description, maxDescriptionLength)
+	preview.SiteName = cleanText(preview.SiteName, maxSiteNameLength)
+	preview.ImageURL = resolveImageURL(preview.ImageURL, base)
+	return preview
+}
+
+// resolveImageURL makes an image URL absolute, dropping anything that isn't http(s)
+func resolveImageURL(raw string, base *url.URL) string {
+	if raw == "" {
+		return ""
+	}
+	ref, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	resolved := base.ResolveReference(ref)
+	if checkScheme(resolved) != nil || len(resolved.String()) > maxImageURLLength {
+		return ""
+	}
+	return resolved.String()
+}
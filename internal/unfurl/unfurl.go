@@ -0,0 +1,214 @@
+// Package unfurl fetches web pages server-side and extracts OpenGraph previews, so
+// clients don't have to fetch links themselves and reveal their IP addresses.
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Defaults for Options fields left at zero
+const (
+	defaultTimeout      = 5 * time.Second
+	defaultMaxBytes     = 512 * 1024
+	defaultMaxRedirects = 3
+	userAgent           = "MessagingSystemLinkPreview/1.0"
+)
+
+var (
+	// ErrBlockedAddress is returned when a URL resolves to an address previews may not fetch
+	ErrBlockedAddress = errors.New("unfurl: address not allowed")
+	// ErrNotHTML is returned when the URL doesn't serve an HTML page
+	ErrNotHTML = errors.New("unfurl: not an HTML page")
+)
+
+// Preview is the summary of a web page shown under a message
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// Options configures a Fetcher
+type Options struct {
+	Timeout      time.Duration // For the whole fetch, redirects included
+	MaxBytes     int64         // Most of the page that is read
+	MaxRedirects int
+	// AllowPrivate permits loopback and private addresses and any port. Only for
+	// tests against a local httptest server.
+	AllowPrivate bool
+}
+
+// Fetcher fetches pages for previews. Connections are only made to public addresses
+// on ports 80 and 443; the check runs on the resolved address at dial time, so DNS
+// tricks and redirects can't reach internal services.
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// New returns a Fetcher with the given options
+func New(opts Options) *Fetcher {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if opts.MaxRedirects <= 0 {
+		opts.MaxRedirects = defaultMaxRedirects
+	}
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivate {
+		dialer.Control = checkDialAddress
+	}
+
+	transport := &http.Transport{
+		// No proxy from the environment: it would dial on our behalf and skip the address check
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	maxRedirects := opts.MaxRedirects
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("unfurl: stopped after %d redirects", maxRedirects)
+			}
+			return checkScheme(req.URL)
+		},
+	}
+
+	return &Fetcher{client: client, maxBytes: opts.MaxBytes}
+}
+
+// Fetch downloads rawURL and extracts its preview. Pages without any title,
+// description or image return an empty Preview and no error.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Preview{}, err
+	}
+	if err := checkScheme(u); err != nil {
+		return Preview{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Preview{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("unfurl: %s returned %s", rawURL, resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return Preview{}, ErrNotHTML
+	}
+
+	preview := parsePreview(io.LimitReader(resp.Body, f.maxBytes), resp.Request.URL)
+	preview.URL = rawURL
+	return preview, nil
+}
+
+// checkScheme only allows plain web URLs
+func checkScheme(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("unfurl: unsupported URL %q", u.Redacted())
+	}
+	if u.User != nil {
+		return fmt.Errorf("unfurl: URLs with credentials are not fetched")
+	}
+	return nil
+}
+
+// checkDialAddress runs right before connecting, on the address DNS resolved to
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if port != "80" && port != "443" {
+		return ErrBlockedAddress
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// blockedNetworks are special-purpose ranges the standard library has no predicate for
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",     // "this" network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"240.0.0.0/4",   // reserved
+	"64:ff9b::/96",  // NAT64, can embed private IPv4 addresses
+	"2002::/16",     // 6to4, same
+)
+
+// isPublicIP reports whether ip is a globally routable unicast address
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return !ip.Equal(net.IPv4bcast)
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// cleanText collapses whitespace, drops invalid UTF-8 and caps the length in runes
+func cleanText(s string, max int) string {
+	s = strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+	if runes := []rune(s); len(runes) > max {
+		s = strings.TrimSpace(string(runes[:max-1])) + "…"
+	}
+	return s
+}